@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/midi"
+	"github.com/ajzaff/go-modular/modules/envelope"
+	"github.com/ajzaff/go-modular/modules/osc"
+	"github.com/ajzaff/go-modular/modules/output/otoplayer"
+)
+
+func main() {
+	cfg := modular.New()
+
+	b := make([]float32, 5*44100)
+	w := osc.Sine(.1, osc.Range16, osc.Fine(midi.StdTuning))
+	w.SetConfig(cfg)
+	w.Process(b)
+
+	// Rhythmic envelope looping in eighth notes.
+	e := envelope.New(
+		envelope.Breakpoint{Time: 10 * time.Millisecond, Level: 1},
+		envelope.Breakpoint{Beats: .5, Curve: -4},
+		envelope.Breakpoint{Time: 10 * time.Millisecond, Level: 1},
+		envelope.Breakpoint{Time: time.Second},
+	)
+	e.SetConfig(cfg)
+	e.SetLoop(0, 2)
+
+	var i int
+	e.SetGate(func() bool {
+		defer func() { i++ }()
+		return i < 4*44100
+	})
+	e.Process(b)
+
+	oto := otoplayer.New()
+	oto.SetConfig(cfg)
+	oto.PlayStereo(b)
+}
@@ -14,6 +14,7 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	defer mid.Close()
 	mid.SetConfig(cfg)
 
 	wave := osc.Saw(.5, osc.Range8, osc.Fine(midi.StdTuning))
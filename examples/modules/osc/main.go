@@ -12,8 +12,9 @@ func main() {
 
 	b := make([]float32, 5*44100)
 	w := osc.Sine(.1, osc.Range8, osc.Fine(midi.StdTuning))
+	a4 := midi.Volts(midi.MustParseNote("A4"))
 	w.Voltage = func() float32 {
-		return 69. / 12
+		return a4
 	}
 	w.SetConfig(cfg)
 	w.Process(b)
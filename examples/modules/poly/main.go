@@ -0,0 +1,89 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/midi"
+	"github.com/ajzaff/go-modular/modules/envelope"
+	"github.com/ajzaff/go-modular/modules/osc"
+	"github.com/ajzaff/go-modular/modules/output/otoplayer"
+	"github.com/ajzaff/go-modular/modules/poly"
+)
+
+// voice is a saw oscillator through an envelope.
+type voice struct {
+	w    *osc.Osc
+	env  *envelope.Envelope
+	on   bool
+	key  float32
+	vel  float32
+	bend float32
+}
+
+func newVoice() poly.Voice {
+	v := &voice{
+		w: osc.Saw(.1, osc.Range8, osc.Fine(midi.StdTuning)),
+		env: envelope.New(
+			envelope.Breakpoint{Time: 5 * time.Millisecond, Level: 1},
+			envelope.Breakpoint{Time: 200 * time.Millisecond, Level: .5, Curve: -3},
+			envelope.Breakpoint{Time: 300 * time.Millisecond, Curve: -3},
+		),
+	}
+	v.w.Voltage = func() float32 { return (v.key + v.bend) / 12 }
+	v.env.SetSustain(1)
+	return v
+}
+
+func (v *voice) SetConfig(cfg *modular.Config) error {
+	if err := v.w.SetConfig(cfg); err != nil {
+		return err
+	}
+	return v.env.SetConfig(cfg)
+}
+
+func (v *voice) NoteOn(key, vel uint8) {
+	v.key, v.vel, v.bend, v.on = float32(key), float32(vel)/127, 0, true
+	v.env.Reset()
+}
+
+func (v *voice) NoteOff()   { v.env.Release() }
+func (v *voice) Done() bool { return !v.on || v.env.Done() }
+
+// Expression applies per-note pitch bend from MPE controllers.
+func (v *voice) Expression(bend, pressure, timbre float32) { v.bend = bend }
+
+func (v *voice) Process(b []float32) {
+	for i := range b {
+		b[i] = v.vel * v.w.Next() * v.env.Envelope()
+	}
+}
+
+func main() {
+	cfg := modular.New()
+
+	p := poly.New(4, newVoice)
+	p.SetConfig(cfg)
+	p.SetStealing(poly.Oldest)
+
+	chord := []int{midi.Note(midi.C, 4), midi.Note(midi.E, 4), midi.Note(midi.G, 4), midi.Note(midi.B, 4)}
+
+	b := make([]float32, 4*44100)
+	for i := 0; i+cfg.SampleSize <= len(b); i += cfg.SampleSize {
+		switch i / cfg.SampleSize {
+		case 0:
+			for _, k := range chord {
+				p.NoteOn(uint8(k), 100)
+			}
+		case 150:
+			for _, k := range chord {
+				p.NoteOff(uint8(k))
+			}
+		}
+		p.Process(b[i : i+cfg.SampleSize])
+	}
+
+	oto := otoplayer.New()
+	oto.SetConfig(cfg)
+	oto.PlayStereo(b)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/midi"
+	"github.com/ajzaff/go-modular/modules/adsr"
+	"github.com/ajzaff/go-modular/modules/osc"
+	"github.com/ajzaff/go-modular/modules/output/otoplayer"
+	"github.com/ajzaff/go-modular/modules/seq"
+)
+
+func main() {
+	cfg := modular.New()
+
+	s := seq.New(
+		seq.Step{Key: midi.Note(midi.C, 3), Gate: .5, Accent: true},
+		seq.Step{Key: midi.Note(midi.C, 4), Gate: .5},
+		seq.Step{Key: midi.Note(midi.Eb, 3), Gate: .25},
+		seq.Step{Key: midi.Note(midi.G, 3), Gate: .5, Prob: .5},
+		seq.Step{},
+		seq.Step{Key: midi.Note(midi.Bb, 3), Gate: 1},
+		seq.Step{Key: midi.Note(midi.C, 4), Gate: .5},
+		seq.Step{Key: midi.Note(midi.F, 3), Gate: .5},
+	)
+	s.SetConfig(cfg)
+	s.SetDirection(seq.PingPong)
+	s.SetTempo(100, 4)
+
+	w := osc.Saw(.1, osc.Range8, osc.Fine(midi.StdTuning))
+	w.SetConfig(cfg)
+	w.Voltage = s.Next
+
+	g := adsr.New(5*time.Millisecond, 50*time.Millisecond, .6, 80*time.Millisecond)
+	g.SetConfig(cfg)
+
+	b := make([]float32, 8*44100)
+	for i := range b {
+		v := w.Next()
+		if s.Trig() {
+			g.Reset()
+		}
+		if !s.Gate() {
+			g.Release()
+		}
+		b[i] = v * g.Envelope()
+	}
+
+	oto := otoplayer.New()
+	oto.SetConfig(cfg)
+	oto.PlayStereo(b)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/midi"
+	midimodule "github.com/ajzaff/go-modular/modules/midi"
+	"github.com/ajzaff/go-modular/modules/osc"
+	"github.com/ajzaff/go-modular/modules/output/otoplayer"
+)
+
+func main() {
+	cfg := modular.New()
+
+	p, err := midimodule.ReadSMFFile(os.Args[1])
+	if err != nil {
+		panic(err)
+	}
+	p.SetConfig(cfg)
+	p.SetPriority(midimodule.Highest)
+
+	gate, pitch := p.GateKey()
+	g := make([]float32, cfg.SampleSize)
+	key := make([]float32, cfg.SampleSize)
+
+	wave := osc.Saw(.1, osc.Range8, osc.Fine(midi.StdTuning))
+	wave.SetConfig(cfg)
+
+	var i int
+	wave.Voltage = func() float32 {
+		v := key[i]
+		i++
+		return v
+	}
+
+	b := make([]float32, p.Len()/int64(cfg.SampleSize)*int64(cfg.SampleSize))
+	for j := 0; j+cfg.SampleSize <= len(b); j += cfg.SampleSize {
+		blk := b[j : j+cfg.SampleSize]
+		pitch.Process(key)
+		i = 0
+		wave.Process(blk)
+		gate.Process(g)
+		for k := range blk {
+			blk[k] *= g[k]
+		}
+	}
+
+	oto := otoplayer.New()
+	oto.SetConfig(cfg)
+	oto.PlayStereo(b)
+}
@@ -0,0 +1,278 @@
+package midi
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// noteNames are the names of the pitch classes with flats
+// matching the note constants.
+var noteNames = [12]string{"C", "Db", "D", "Eb", "E", "F", "Gb", "G", "Ab", "A", "Bb", "B"}
+
+// letterSemis are the semitones of the natural notes above C.
+var letterSemis = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// parsePitchClass parses a note letter and accidentals at the start of s.
+//
+// It returns the semitones above C and the rest of s.
+func parsePitchClass(s string) (int, string, error) {
+	if s == "" {
+		return 0, "", fmt.Errorf("missing note")
+	}
+	semis, ok := letterSemis[strings.ToUpper(s[:1])[0]]
+	if !ok {
+		return 0, "", fmt.Errorf("invalid note letter %q", s[:1])
+	}
+	s = s[1:]
+	for len(s) > 0 {
+		switch s[0] {
+		case '#':
+			semis++
+		case 'b':
+			semis--
+		default:
+			return semis, s, nil
+		}
+		s = s[1:]
+	}
+	return semis, s, nil
+}
+
+// ParseNote parses a note name and returns its fractional MIDI key.
+//
+// A note name is a letter from A to G, any number of sharps (#) or
+// flats (b), an octave and an optional offset in cents:
+//
+//	C#3    // 49
+//	Bb-1   // 10
+//	A4+25c // 69.25
+//
+// Octaves follow the convention of Note where C4 is key 60.
+func ParseNote(s string) (float32, error) {
+	semis, rest, err := parsePitchClass(s)
+	if err != nil {
+		return 0, fmt.Errorf("midi.ParseNote: %v", err)
+	}
+	// The octave ends at the cents sign following a digit.
+	i := 0
+	if i < len(rest) && rest[i] == '-' {
+		i++
+	}
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	oct, err := strconv.Atoi(rest[:i])
+	if err != nil {
+		return 0, fmt.Errorf("midi.ParseNote: invalid octave in %q", s)
+	}
+	key := float64(semis + Note(C, oct))
+	if rest = rest[i:]; rest != "" {
+		c, ok := parseCents(rest)
+		if !ok {
+			return 0, fmt.Errorf("midi.ParseNote: invalid cents in %q", s)
+		}
+		key += c / 100
+	}
+	return float32(key), nil
+}
+
+// parseCents parses a signed decimal offset in cents
+// with an optional "c" suffix such as "+25c" or "-3.5".
+func parseCents(s string) (float64, bool) {
+	s = strings.TrimSuffix(s, "c")
+	if len(s) < 2 || s[0] != '+' && s[0] != '-' {
+		return 0, false
+	}
+	digits, dot := 0, false
+	for _, r := range s[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '.' && !dot:
+			dot = true
+		default:
+			return 0, false
+		}
+	}
+	if digits == 0 {
+		return 0, false
+	}
+	c, err := strconv.ParseFloat(s, 64)
+	return c, err == nil
+}
+
+// MustParseNote is like ParseNote but panics if the name is invalid.
+func MustParseNote(s string) float32 {
+	key, err := ParseNote(s)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// NoteName returns the name of the fractional MIDI key.
+//
+// The name is spelled with flats like the note constants.
+// Keys between semitones are named after the nearest key
+// with an offset in whole cents, for instance "A4+25c".
+func NoteName(key float32) string {
+	k := int(math.Round(float64(key)))
+	return noteName(k, int(math.Round(100*(float64(key)-float64(k)))))
+}
+
+func noteName(key, cents int) string {
+	name := fmt.Sprintf("%s%d", noteNames[mod12(key)], floorDiv(key, 12)-1)
+	if cents != 0 {
+		name += fmt.Sprintf("%+dc", cents)
+	}
+	return name
+}
+
+// FreqName returns the name of the key nearest to frequency f
+// in tuning t with the offset of f in whole cents.
+//
+// For instance FreqName(StdTuning, 446) is "A4+23c".
+// It returns "" if KeyCents finds no key.
+func FreqName(t Tuning, f float32) string {
+	k, c := KeyCents(t, f)
+	if k < 0 {
+		return ""
+	}
+	return noteName(k, int(math.Round(float64(c))))
+}
+
+// Volts returns the control voltage of the fractional MIDI key at 1V/oct.
+func Volts(key float32) float32 {
+	return key / 12
+}
+
+// Interval constants in semitones.
+const (
+	Unison        = 0
+	MinorSecond   = 1
+	MajorSecond   = 2
+	MinorThird    = 3
+	MajorThird    = 4
+	PerfectFourth = 5
+	Tritone       = 6
+	PerfectFifth  = 7
+	MinorSixth    = 8
+	MajorSixth    = 9
+	MinorSeventh  = 10
+	MajorSeventh  = 11
+	Octave        = 12
+	MinorNinth    = 13
+	MajorNinth    = 14
+)
+
+// Chord is a list of semitones above the root in ascending order.
+type Chord []int
+
+// Chord constants.
+var (
+	MajorChord           = Chord{Unison, MajorThird, PerfectFifth}
+	MinorChord           = Chord{Unison, MinorThird, PerfectFifth}
+	DiminishedChord      = Chord{Unison, MinorThird, Tritone}
+	AugmentedChord       = Chord{Unison, MajorThird, MinorSixth}
+	Sus2Chord            = Chord{Unison, MajorSecond, PerfectFifth}
+	Sus4Chord            = Chord{Unison, PerfectFourth, PerfectFifth}
+	Major6Chord          = Chord{Unison, MajorThird, PerfectFifth, MajorSixth}
+	Minor6Chord          = Chord{Unison, MinorThird, PerfectFifth, MajorSixth}
+	Dominant7Chord       = Chord{Unison, MajorThird, PerfectFifth, MinorSeventh}
+	Major7Chord          = Chord{Unison, MajorThird, PerfectFifth, MajorSeventh}
+	Minor7Chord          = Chord{Unison, MinorThird, PerfectFifth, MinorSeventh}
+	MinorMajor7Chord     = Chord{Unison, MinorThird, PerfectFifth, MajorSeventh}
+	HalfDiminished7Chord = Chord{Unison, MinorThird, Tritone, MinorSeventh}
+	Diminished7Chord     = Chord{Unison, MinorThird, Tritone, MajorSixth}
+	Add9Chord            = Chord{Unison, MajorThird, PerfectFifth, MajorNinth}
+	Dominant9Chord       = Chord{Unison, MajorThird, PerfectFifth, MinorSeventh, MajorNinth}
+	Major9Chord          = Chord{Unison, MajorThird, PerfectFifth, MajorSeventh, MajorNinth}
+	Minor9Chord          = Chord{Unison, MinorThird, PerfectFifth, MinorSeventh, MajorNinth}
+)
+
+// chordSymbols maps chord symbol suffixes to chords.
+var chordSymbols = map[string]Chord{
+	"":     MajorChord,
+	"maj":  MajorChord,
+	"M":    MajorChord,
+	"m":    MinorChord,
+	"min":  MinorChord,
+	"-":    MinorChord,
+	"dim":  DiminishedChord,
+	"aug":  AugmentedChord,
+	"+":    AugmentedChord,
+	"sus2": Sus2Chord,
+	"sus4": Sus4Chord,
+	"sus":  Sus4Chord,
+	"6":    Major6Chord,
+	"m6":   Minor6Chord,
+	"7":    Dominant7Chord,
+	"maj7": Major7Chord,
+	"M7":   Major7Chord,
+	"m7":   Minor7Chord,
+	"min7": Minor7Chord,
+	"mM7":  MinorMajor7Chord,
+	"m7b5": HalfDiminished7Chord,
+	"dim7": Diminished7Chord,
+	"add9": Add9Chord,
+	"9":    Dominant9Chord,
+	"maj9": Major9Chord,
+	"M9":   Major9Chord,
+	"m9":   Minor9Chord,
+	"min9": Minor9Chord,
+}
+
+// ParseChord parses a chord symbol such as "Cmaj7" or "F#m".
+//
+// It returns the root as a note constant from C to B and the chord.
+//
+// Example:
+//
+//	root, c, _ := ParseChord("Cmaj7")
+//	keys := c.Keys(Note(root, 4)) // 60 64 67 71
+func ParseChord(s string) (root int, c Chord, err error) {
+	semis, rest, err := parsePitchClass(s)
+	if err != nil {
+		return 0, nil, fmt.Errorf("midi.ParseChord: %v", err)
+	}
+	c, ok := chordSymbols[rest]
+	if !ok {
+		return 0, nil, fmt.Errorf("midi.ParseChord: unknown chord %q", rest)
+	}
+	return C + mod12(semis), append(Chord(nil), c...), nil
+}
+
+// Keys returns the keys of the chord with the given root key.
+func (c Chord) Keys(root int) []int {
+	keys := make([]int, len(c))
+	for i, v := range c {
+		keys[i] = root + v
+	}
+	return keys
+}
+
+// Inversion returns the nth inversion of the chord.
+//
+// The lowest n notes are raised by an octave. The result is
+// relative to the root of c and may not start at 0.
+func (c Chord) Inversion(n int) Chord {
+	if len(c) == 0 {
+		return nil
+	}
+	res := make(Chord, len(c))
+	for i := range c {
+		j := i + n
+		res[i] = c[mod(j, len(c))] + Octave*floorDiv(j, len(c))
+	}
+	return res
+}
+
+func floorDiv(v, n int) int {
+	q := v / n
+	if v%n != 0 && v < 0 {
+		q--
+	}
+	return q
+}
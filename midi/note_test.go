@@ -0,0 +1,245 @@
+package midi
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseNote(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want float32
+	}{
+		{"C4", 60},
+		{"c4", 60},
+		{"C#3", 49},
+		{"Bb-1", 10},
+		{"C-1", 0},
+		{"G9", 127},
+		{"B#3", 60},
+		{"Ebb4", 62},
+		{"A4", 69},
+		{"A4+25c", 69.25},
+		{"A4-50", 68.5},
+		{"A4+12.5c", 69.125},
+	} {
+		got, err := ParseNote(tc.in)
+		if err != nil {
+			t.Errorf("ParseNote(%q): %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseNote(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseNoteErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"H4",
+		"C",
+		"C#",
+		"C-",
+		"C4x",
+		"C4+",
+		"C4+c",
+		"C4+.c",
+		"C4 +25c",
+		"C4+25cc",
+		"C4+2.5.0",
+		"C4+Inf",
+		"C4-Infc",
+		"C4+NaN",
+		"C4+1e3",
+		"C4+0x10",
+		"C4+1_0",
+	} {
+		if got, err := ParseNote(in); err == nil {
+			t.Errorf("ParseNote(%q) = %v, want error", in, got)
+		}
+	}
+}
+
+func TestNoteName(t *testing.T) {
+	for _, tc := range []struct {
+		key  float32
+		want string
+	}{
+		{60, "C4"},
+		{61, "Db4"},
+		{69, "A4"},
+		{0, "C-1"},
+		{11, "B-1"},
+		{127, "G9"},
+		{69.25, "A4+25c"},
+		{68.75, "A4-25c"},
+		{-1, "B-2"},
+	} {
+		if got := NoteName(tc.key); got != tc.want {
+			t.Errorf("NoteName(%v) = %q, want %q", tc.key, got, tc.want)
+		}
+		if got := MustParseNote(NoteName(tc.key)); got != tc.key {
+			t.Errorf("ParseNote(NoteName(%v)) = %v", tc.key, got)
+		}
+	}
+}
+
+func TestFreqName(t *testing.T) {
+	for _, tc := range []struct {
+		f    float32
+		want string
+	}{
+		{440, "A4"},
+		{446, "A4+23c"},
+		{261.63, "C4"},
+		{27.5, "A0"},
+		{0, ""},
+		{-440, ""},
+	} {
+		if got := FreqName(StdTuning, tc.f); got != tc.want {
+			t.Errorf("FreqName(StdTuning, %v) = %q, want %q", tc.f, got, tc.want)
+		}
+	}
+	if got := FreqName(&Table{}, 440); got != "" {
+		t.Errorf("FreqName of an empty table = %q, want \"\"", got)
+	}
+}
+
+func TestKeyCents(t *testing.T) {
+	// A table with only C4 and E4 mapped.
+	var sparse Table
+	sparse[60], sparse[64] = 261.63, 329.63
+
+	for _, tc := range []struct {
+		name  string
+		t     Tuning
+		f     float32
+		key   int
+		cents float32
+	}{
+		{"A440", StdTuning, 440, 69, 0},
+		{"sharp", StdTuning, 440 * float32(math.Exp2(30./1200)), 69, 30},
+		{"flat", StdTuning, 440 * float32(math.Exp2(-30./1200)), 69, -30},
+		{"zero", StdTuning, 0, -1, 0},
+		{"negative", StdTuning, -440, -1, 0},
+		{"table", NewTable(StdTuning), 440, 69, 0},
+		{"table zero", NewTable(StdTuning), 0, -1, 0},
+		{"sparse", &sparse, 280, 60, float32(1200 * math.Log2(280/261.63))},
+		{"sparse high", &sparse, 320, 64, float32(1200 * math.Log2(320/329.63))},
+		{"empty table", &Table{}, 440, -1, 0},
+	} {
+		key, cents := KeyCents(tc.t, tc.f)
+		if key != tc.key || math.Abs(float64(cents-tc.cents)) > 1e-3 {
+			t.Errorf("%s: KeyCents(%v) = %d, %v, want %d, %v", tc.name, tc.f, key, cents, tc.key, tc.cents)
+		}
+	}
+}
+
+func TestParseChord(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		root int
+		want Chord
+	}{
+		{"C", C, MajorChord},
+		{"Cmaj7", C, Major7Chord},
+		{"F#m", Gb, MinorChord},
+		{"Bbdim7", Bb, Diminished7Chord},
+		{"Am7b5", A, HalfDiminished7Chord},
+		{"B#", C, MajorChord},
+		{"Cb9", B, Dominant9Chord},
+		{"Gsus", G, Sus4Chord},
+	} {
+		root, c, err := ParseChord(tc.in)
+		if err != nil {
+			t.Errorf("ParseChord(%q): %v", tc.in, err)
+			continue
+		}
+		if root != tc.root || !reflect.DeepEqual(c, tc.want) {
+			t.Errorf("ParseChord(%q) = %d, %v, want %d, %v", tc.in, root, c, tc.root, tc.want)
+		}
+	}
+	for _, in := range []string{"", "X", "Cfoo", "C7#11"} {
+		if _, _, err := ParseChord(in); err == nil {
+			t.Errorf("ParseChord(%q): want error", in)
+		}
+	}
+
+	// The result is a copy.
+	_, c, _ := ParseChord("C")
+	c[0] = 1
+	if MajorChord[0] != 0 {
+		t.Errorf("ParseChord modified MajorChord")
+	}
+}
+
+func TestChordKeys(t *testing.T) {
+	root, c, _ := ParseChord("Cmaj7")
+	if got, want := c.Keys(Note(root, 4)), []int{60, 64, 67, 71}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys = %v, want %v", got, want)
+	}
+}
+
+func TestInversion(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		want Chord
+	}{
+		{0, Chord{0, 4, 7}},
+		{1, Chord{4, 7, 12}},
+		{2, Chord{7, 12, 16}},
+		{3, Chord{12, 16, 19}},
+		{-1, Chord{-5, 0, 4}},
+	} {
+		if got := MajorChord.Inversion(tc.n); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Inversion(%d) = %v, want %v", tc.n, got, tc.want)
+		}
+	}
+	if got := Chord(nil).Inversion(1); got != nil {
+		t.Errorf("empty Inversion = %v, want nil", got)
+	}
+}
+
+func TestScaleDegree(t *testing.T) {
+	for _, tc := range []struct {
+		s    Scale
+		d    int
+		want int
+	}{
+		{Major, 0, 60},
+		{Major, 2, 64},
+		{Major, 6, 71},
+		{Major, 7, 72},
+		{Major, 9, 76},
+		{Major, -1, 59},
+		{Major, -7, 48},
+		{Scale(0), 3, 63},
+	} {
+		if got := tc.s.Degree(60, tc.d); got != tc.want {
+			t.Errorf("%v.Degree(60, %d) = %d, want %d", tc.s, tc.d, got, tc.want)
+		}
+	}
+	if got, want := Major.Keys(60, 8), []int{60, 62, 64, 65, 67, 69, 71, 72}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Major.Keys = %v, want %v", got, want)
+	}
+}
+
+func TestScaleChord(t *testing.T) {
+	for _, tc := range []struct {
+		d, n int
+		want Chord
+	}{
+		{0, 3, MajorChord},
+		{1, 3, MinorChord},
+		{4, 4, Dominant7Chord},
+		{0, 4, Major7Chord},
+		{6, 4, HalfDiminished7Chord},
+		{0, 5, Major9Chord},
+	} {
+		if got := Major.Chord(tc.d, tc.n); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Major.Chord(%d, %d) = %v, want %v", tc.d, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package midi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scl is a Scala scale.
+//
+// Degrees are given in cents above the root. The last degree is the
+// period of the scale, usually an octave of 1200 cents.
+type Scl struct {
+	Description string
+	Cents       []float64
+}
+
+// EDO returns the scale dividing the octave in n equal steps.
+func EDO(n int) *Scl {
+	s := &Scl{Description: fmt.Sprintf("%d equal divisions of the octave", n)}
+	for i := 1; i <= n; i++ {
+		s.Cents = append(s.Cents, 1200*float64(i)/float64(n))
+	}
+	return s
+}
+
+// Ratios returns the scale with the given frequency ratios above the root.
+//
+// The last ratio is the period of the scale, usually 2.
+func Ratios(ratios ...float64) *Scl {
+	s := &Scl{}
+	for _, r := range ratios {
+		s.Cents = append(s.Cents, 1200*math.Log2(r))
+	}
+	return s
+}
+
+// JustIntonation returns the 12-tone 5-limit just intonation scale.
+func JustIntonation() *Scl {
+	s := Ratios(16./15, 9./8, 6./5, 5./4, 4./3, 45./32, 3./2, 8./5, 5./3, 9./5, 15./8, 2)
+	s.Description = "5-limit just intonation"
+	return s
+}
+
+// Len returns the number of degrees per period.
+func (s *Scl) Len() int {
+	return len(s.Cents)
+}
+
+// cents returns the cents of degree d above the root.
+func (s *Scl) cents(d int) float64 {
+	n := len(s.Cents)
+	oct, r := d/n, d%n
+	if r < 0 {
+		oct, r = oct-1, r+n
+	}
+	c := float64(oct) * s.Cents[n-1]
+	if r > 0 {
+		c += s.Cents[r-1]
+	}
+	return c
+}
+
+// Table returns the tuning table of the scale with the keyboard mapping m.
+//
+// A nil mapping maps degree 0 to key 60 and consecutive keys to
+// consecutive degrees, with key 69 at 440 Hz.
+func (s *Scl) Table(m *Kbm) (*Table, error) {
+	if len(s.Cents) == 0 {
+		return nil, fmt.Errorf("midi.Scl.Table: empty scale")
+	}
+	if m == nil {
+		m = DefaultKbm()
+	}
+	ref, ok := m.degree(m.RefKey)
+	if !ok {
+		return nil, fmt.Errorf("midi.Scl.Table: reference key %d is unmapped", m.RefKey)
+	}
+	refCents := s.cents(ref)
+	var t Table
+	for k := range t {
+		if k < m.First || k > m.Last {
+			continue
+		}
+		if d, ok := m.degree(k); ok {
+			t[k] = float32(m.RefHz * math.Exp2((s.cents(d)-refCents)/1200))
+		}
+	}
+	return &t, nil
+}
+
+// Kbm is a Scala keyboard mapping.
+type Kbm struct {
+	// First and Last are the range of keys to retune.
+	First, Last int
+	// Middle is the key mapped to degree 0.
+	Middle int
+	// RefKey is the key tuned to RefHz.
+	RefKey int
+	RefHz  float64
+	// Octave is the degree of the formal octave used to repeat Map.
+	Octave int
+	// Map maps keys from Middle to scale degrees, or -1 for unmapped keys.
+	//
+	// An empty Map maps consecutive keys to consecutive degrees.
+	Map []int
+}
+
+// DefaultKbm returns the linear mapping with degree 0 on key 60
+// and key 69 at 440 Hz.
+func DefaultKbm() *Kbm {
+	return &Kbm{First: 0, Last: 127, Middle: 60, RefKey: 69, RefHz: 440}
+}
+
+// degree returns the scale degree of key k.
+func (m *Kbm) degree(k int) (int, bool) {
+	off := k - m.Middle
+	n := len(m.Map)
+	if n == 0 {
+		return off, true
+	}
+	oct, r := off/n, off%n
+	if r < 0 {
+		oct, r = oct-1, r+n
+	}
+	if m.Map[r] < 0 {
+		return 0, false
+	}
+	return oct*m.Octave + m.Map[r], true
+}
+
+// scalaLines returns the non-comment lines of a Scala file.
+func scalaLines(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.HasPrefix(line, "!") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
+}
+
+// firstField returns the first field of the line or the empty string.
+func firstField(line string) string {
+	if f := strings.Fields(line); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// ParseScl parses a Scala .scl scale file.
+func ParseScl(r io.Reader) (*Scl, error) {
+	lines, err := scalaLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("midi.ParseScl: %v", err)
+	}
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("midi.ParseScl: missing header")
+	}
+	s := &Scl{Description: strings.TrimSpace(lines[0])}
+	n, err := strconv.Atoi(firstField(lines[1]))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("midi.ParseScl: invalid note count %q", lines[1])
+	}
+	var notes []string
+	for _, line := range lines[2:] {
+		if f := firstField(line); f != "" {
+			notes = append(notes, f)
+		}
+	}
+	if len(notes) < n {
+		return nil, fmt.Errorf("midi.ParseScl: got %d notes, want %d", len(notes), n)
+	}
+	for _, v := range notes[:n] {
+		c, err := parsePitch(v)
+		if err != nil {
+			return nil, fmt.Errorf("midi.ParseScl: %v", err)
+		}
+		s.Cents = append(s.Cents, c)
+	}
+	return s, nil
+}
+
+// parsePitch parses a Scala pitch in cents or as a ratio.
+func parsePitch(v string) (float64, error) {
+	if strings.Contains(v, ".") {
+		c, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cents %q", v)
+		}
+		return c, nil
+	}
+	num, den := v, "1"
+	if i := strings.IndexByte(v, '/'); i >= 0 {
+		num, den = v[:i], v[i+1:]
+	}
+	a, err1 := strconv.ParseUint(num, 10, 64)
+	b, err2 := strconv.ParseUint(den, 10, 64)
+	if err1 != nil || err2 != nil || a == 0 || b == 0 {
+		return 0, fmt.Errorf("invalid ratio %q", v)
+	}
+	return 1200 * math.Log2(float64(a)/float64(b)), nil
+}
+
+// ParseKbm parses a Scala .kbm keyboard mapping file.
+func ParseKbm(r io.Reader) (*Kbm, error) {
+	lines, err := scalaLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("midi.ParseKbm: %v", err)
+	}
+	var fields []string
+	for _, line := range lines {
+		if f := firstField(line); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("midi.ParseKbm: missing header")
+	}
+	var ints [7]int
+	for i, f := range fields[:7] {
+		if i == 5 {
+			continue
+		}
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("midi.ParseKbm: invalid value %q", f)
+		}
+		ints[i] = v
+	}
+	refHz, err := strconv.ParseFloat(fields[5], 64)
+	if err != nil || refHz <= 0 {
+		return nil, fmt.Errorf("midi.ParseKbm: invalid reference frequency %q", fields[5])
+	}
+	size := ints[0]
+	m := &Kbm{
+		First:  ints[1],
+		Last:   ints[2],
+		Middle: ints[3],
+		RefKey: ints[4],
+		RefHz:  refHz,
+		Octave: ints[6],
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("midi.ParseKbm: invalid map size %d", size)
+	}
+	// Missing entries at the end are unmapped.
+	for i := 0; i < size; i++ {
+		d := -1
+		if j := 7 + i; j < len(fields) && fields[j] != "x" {
+			if d, err = strconv.Atoi(fields[j]); err != nil || d < 0 {
+				return nil, fmt.Errorf("midi.ParseKbm: invalid mapping %q", fields[j])
+			}
+		}
+		m.Map = append(m.Map, d)
+	}
+	return m, nil
+}
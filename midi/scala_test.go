@@ -0,0 +1,260 @@
+package midi
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// meanquar is the example scale of the Scala file format documentation.
+const meanquar = `! meanquar.scl
+!
+1/4-comma meantone scale. Pietro Aaron's temperament (1523)
+ 12
+!
+ 76.04900
+ 193.15686
+ 310.26471
+ 5/4
+ 503.42157
+ 579.47057
+ 696.57843
+ 25/16
+ 889.73529
+ 1006.84314
+ 1082.89214
+ 2/1
+`
+
+// whiteKeys is adapted from the keyboard mapping template of the
+// Scala file format documentation. It maps a 7-note scale to the
+// white keys.
+const whiteKeys = `! Template for a keyboard mapping
+!
+! Size of map. The pattern repeats every so many keys:
+12
+! First MIDI note number to retune:
+0
+! Last MIDI note number to retune:
+127
+! Middle note where the first entry of the mapping is mapped to:
+60
+! Reference note for which frequency is given:
+69
+! Frequency to tune the above note to (floating point e.g. 440.0):
+440.0
+! Scale degree to consider as formal octave (determines difference in pitch
+! between adjacent mapping patterns):
+7
+! Mapping.
+! The numbers represent scale degrees mapped to keys. The first entry is for
+! the given middle note, the next for subsequent higher keys.
+! For an unmapped key, put in an "x". At the end, unmapped keys may be left out.
+0
+x
+1
+x
+2
+3
+x
+4
+x
+5
+x
+6
+`
+
+func cents(r float64) float64 {
+	return 1200 * math.Log2(r)
+}
+
+func TestParseScl(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want *Scl
+	}{{
+		name: "meanquar",
+		in:   meanquar,
+		want: &Scl{
+			Description: "1/4-comma meantone scale. Pietro Aaron's temperament (1523)",
+			Cents: []float64{
+				76.049, 193.15686, 310.26471, cents(5. / 4), 503.42157, 579.47057,
+				696.57843, cents(25. / 16), 889.73529, 1006.84314, 1082.89214, 1200,
+			},
+		},
+	}, {
+		name: "empty description",
+		in:   "\n 2\n 700.\n 2\n",
+		want: &Scl{Cents: []float64{700, 1200}},
+	}, {
+		name: "trailing text and crlf",
+		in:   "Fifths\r\n2\r\n701.955 cents\r\n2/1 octave\r\n",
+		want: &Scl{Description: "Fifths", Cents: []float64{701.955, 1200}},
+	}, {
+		name: "integer ratio",
+		in:   "Tritave\n1\n3\n",
+		want: &Scl{Description: "Tritave", Cents: []float64{cents(3)}},
+	}, {
+		name: "negative cents",
+		in:   "Down\n2\n-100.0\n1200.0\n",
+		want: &Scl{Description: "Down", Cents: []float64{-100, 1200}},
+	}, {
+		name: "no notes",
+		in:   "Empty\n0\n",
+		want: &Scl{Description: "Empty"},
+	}, {
+		name: "extra notes",
+		in:   "Two\n1\n2/1\n3/1\n",
+		want: &Scl{Description: "Two", Cents: []float64{1200}},
+	}} {
+		got, err := ParseScl(strings.NewReader(tc.in))
+		if err != nil {
+			t.Errorf("%s: ParseScl: %v", tc.name, err)
+			continue
+		}
+		if got.Description != tc.want.Description || len(got.Cents) != len(tc.want.Cents) {
+			t.Errorf("%s: ParseScl = %+v, want %+v", tc.name, got, tc.want)
+			continue
+		}
+		for i, c := range got.Cents {
+			if math.Abs(c-tc.want.Cents[i]) > 1e-9 {
+				t.Errorf("%s: degree %d = %v cents, want %v", tc.name, i+1, c, tc.want.Cents[i])
+			}
+		}
+	}
+}
+
+func TestParseSclErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"comments only", "! a.scl\n!\n"},
+		{"missing count", "Scale\n"},
+		{"invalid count", "Scale\ntwelve\n"},
+		{"negative count", "Scale\n-1\n"},
+		{"missing notes", "Scale\n3\n100.0\n2/1\n"},
+		{"invalid cents", "Scale\n1\n1.2.3\n"},
+		{"invalid ratio", "Scale\n1\n3/x\n"},
+		{"zero ratio", "Scale\n1\n0/1\n"},
+		{"zero denominator", "Scale\n1\n3/0\n"},
+		{"negative ratio", "Scale\n1\n-3/2\n"},
+	} {
+		if s, err := ParseScl(strings.NewReader(tc.in)); err == nil {
+			t.Errorf("%s: ParseScl = %+v, want error", tc.name, s)
+		}
+	}
+}
+
+func TestParseKbm(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want *Kbm
+	}{{
+		name: "white keys",
+		in:   whiteKeys,
+		want: &Kbm{
+			First: 0, Last: 127, Middle: 60, RefKey: 69, RefHz: 440, Octave: 7,
+			Map: []int{0, -1, 1, -1, 2, 3, -1, 4, -1, 5, -1, 6},
+		},
+	}, {
+		name: "linear",
+		in:   "0\n0\n127\n60\n69\n440.0\n0\n",
+		want: &Kbm{First: 0, Last: 127, Middle: 60, RefKey: 69, RefHz: 440},
+	}, {
+		name: "missing entries are unmapped",
+		in:   "4\n21\n108\n60\n69\n432\n12\n0\n1\n",
+		want: &Kbm{
+			First: 21, Last: 108, Middle: 60, RefKey: 69, RefHz: 432, Octave: 12,
+			Map: []int{0, 1, -1, -1},
+		},
+	}} {
+		got, err := ParseKbm(strings.NewReader(tc.in))
+		if err != nil {
+			t.Errorf("%s: ParseKbm: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: ParseKbm = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseKbmErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"short header", "12\n0\n127\n60\n69\n440.0\n"},
+		{"invalid key", "0\n0\nlast\n60\n69\n440.0\n0\n"},
+		{"invalid frequency", "0\n0\n127\n60\n69\nA440\n0\n"},
+		{"zero frequency", "0\n0\n127\n60\n69\n0\n0\n"},
+		{"negative size", "-1\n0\n127\n60\n69\n440.0\n0\n"},
+		{"invalid mapping", "2\n0\n127\n60\n69\n440.0\n2\n0\ny\n"},
+		{"negative mapping", "2\n0\n127\n60\n69\n440.0\n2\n0\n-1\n"},
+	} {
+		if m, err := ParseKbm(strings.NewReader(tc.in)); err == nil {
+			t.Errorf("%s: ParseKbm = %+v, want error", tc.name, m)
+		}
+	}
+}
+
+func TestSclTable(t *testing.T) {
+	s, err := ParseScl(strings.NewReader(meanquar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseKbm(strings.NewReader(whiteKeys))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A 12-tone scale with the default mapping puts A4 at 440 Hz
+	// and repeats every 12 keys.
+	tab, err := s.Table(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tab[69] != 440 || math.Abs(float64(tab[81]-880)) > 1e-3 {
+		t.Errorf("got A4 %v A5 %v, want 440 880", tab[69], tab[81])
+	}
+	// The major third above C4 is pure.
+	if r := float64(tab[64] / tab[60]); math.Abs(r-5./4) > 1e-6 {
+		t.Errorf("got C4-E4 ratio %v, want 5/4", r)
+	}
+
+	// The white key mapping plays the first 7 degrees and leaves
+	// the black keys unmapped.
+	tab, err = EDO(7).Table(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tab[61] != 0 || tab[70] != 0 {
+		t.Errorf("got black keys %v %v, want unmapped", tab[61], tab[70])
+	}
+	if tab[69] != 440 {
+		t.Errorf("got reference %v, want 440", tab[69])
+	}
+	step := math.Exp2(1. / 7)
+	for _, k := range []int{60, 62, 64, 65, 67, 69, 71, 72} {
+		d, _ := m.degree(k)
+		want := 440 * math.Pow(step, float64(d-5))
+		if math.Abs(float64(tab[k])-want) > 1e-3 {
+			t.Errorf("key %d: got %v Hz, want %v", k, tab[k], want)
+		}
+	}
+
+	// The reference key must be mapped.
+	m.RefKey = 70
+	if _, err := EDO(7).Table(m); err == nil {
+		t.Errorf("Table with an unmapped reference key: want error")
+	}
+	if _, err := (&Scl{}).Table(nil); err == nil {
+		t.Errorf("Table of an empty scale: want error")
+	}
+}
@@ -0,0 +1,160 @@
+package midi
+
+// Scale is a set of pitch classes.
+//
+// Bit i is set when the note i semitones above the root is in the scale.
+type Scale uint16
+
+// Scale constants.
+const (
+	Chromatic       Scale = 0b111111111111
+	Major           Scale = 0b101010110101 // Ionian
+	Dorian          Scale = 0b011010101101
+	Phrygian        Scale = 0b010110101011
+	Lydian          Scale = 0b101011010101
+	Mixolydian      Scale = 0b011010110101
+	Minor           Scale = 0b010110101101 // Aeolian
+	Locrian         Scale = 0b010101101011
+	HarmonicMinor   Scale = 0b100110101101
+	MelodicMinor    Scale = 0b101010101101
+	MajorPentatonic Scale = 0b001010010101
+	MinorPentatonic Scale = 0b010010101001
+	Blues           Scale = 0b010011101001
+	WholeTone       Scale = 0b010101010101
+)
+
+// NewScale returns the scale containing the given semitones above the root.
+//
+// Semitones are taken modulo 12.
+func NewScale(semitones ...int) Scale {
+	var s Scale
+	for _, v := range semitones {
+		s |= 1 << uint(mod12(v))
+	}
+	return s
+}
+
+func mod12(v int) int {
+	v %= 12
+	if v < 0 {
+		v += 12
+	}
+	return v
+}
+
+// Contains returns true if the scale contains the note
+// the given number of semitones above the root.
+func (s Scale) Contains(semitones int) bool {
+	return s&(1<<uint(mod12(semitones))) != 0
+}
+
+// Semitones returns the semitones above the root in the scale in ascending order.
+func (s Scale) Semitones() []int {
+	var res []int
+	for i := 0; i < 12; i++ {
+		if s.Contains(i) {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// Len returns the number of notes in the scale.
+func (s Scale) Len() int {
+	var n int
+	for i := 0; i < 12; i++ {
+		if s.Contains(i) {
+			n++
+		}
+	}
+	return n
+}
+
+// Mode returns the nth mode of the scale.
+//
+// For instance Major.Mode(5) is Minor.
+func (s Scale) Mode(n int) Scale {
+	semis := s.Semitones()
+	if len(semis) == 0 {
+		return s
+	}
+	root := semis[mod(n, len(semis))]
+	var res Scale
+	for _, v := range semis {
+		res |= 1 << uint(mod12(v-root))
+	}
+	return res
+}
+
+func mod(v, n int) int {
+	v %= n
+	if v < 0 {
+		v += n
+	}
+	return v
+}
+
+// Degree returns the key of scale degree d with the given root key.
+//
+// Degree 0 is the root. Degrees beyond the scale continue in the
+// octaves above and negative degrees in the octaves below.
+// An empty scale is treated as Chromatic.
+func (s Scale) Degree(root, d int) int {
+	semis := s.Semitones()
+	if len(semis) == 0 {
+		semis = Chromatic.Semitones()
+	}
+	n := len(semis)
+	return root + semis[mod(d, n)] + 12*floorDiv(d, n)
+}
+
+// Keys returns n ascending keys of the scale starting at the root key.
+func (s Scale) Keys(root, n int) []int {
+	keys := make([]int, n)
+	for i := range keys {
+		keys[i] = s.Degree(root, i)
+	}
+	return keys
+}
+
+// Chord returns the chord of n notes stacked in thirds
+// on scale degree d.
+//
+// For instance Major.Chord(0, 4) is Major7Chord and
+// Major.Chord(1, 3) is MinorChord.
+func (s Scale) Chord(d, n int) Chord {
+	base := s.Degree(0, d)
+	c := make(Chord, n)
+	for i := range c {
+		c[i] = s.Degree(0, d+2*i) - base
+	}
+	return c
+}
+
+// Quantize returns the key nearest to the fractional key in scale s with the given root note.
+//
+// Ties are resolved toward the lower key.
+// An empty scale is treated as Chromatic.
+func (s Scale) Quantize(root int, key float32) int {
+	if s&Chromatic == 0 {
+		s = Chromatic
+	}
+	k0 := int(key)
+	if key < 0 {
+		k0--
+	}
+	best, dist := k0, float32(-1)
+	for k := k0 - 6; k <= k0+7; k++ {
+		if !s.Contains(k - root) {
+			continue
+		}
+		d := key - float32(k)
+		if d < 0 {
+			d = -d
+		}
+		if dist < 0 || d < dist {
+			best, dist = k, d
+		}
+	}
+	return best
+}
@@ -0,0 +1,80 @@
+package midi
+
+import "math"
+
+// Table is a tuning table with the frequency of every MIDI key.
+//
+// Unmapped keys have frequency 0.
+type Table [128]float32
+
+// NewTable returns the table of the tuning t.
+func NewTable(t Tuning) *Table {
+	var tab Table
+	for k := range tab {
+		tab[k] = Pitch(t, k)
+	}
+	return &tab
+}
+
+// A4Hz returns the frequency of key 69.
+func (t *Table) A4Hz() float32 {
+	return t[69]
+}
+
+// Hz returns the frequency of the fractional key.
+//
+// Fractional keys are interpolated in pitch between the neighboring keys.
+// Keys outside the table are extrapolated from the outermost steps.
+func (t *Table) Hz(key float32) float32 {
+	return TableHz(func(k int) float32 { return t[k] }, key)
+}
+
+// TableHz returns the frequency of the fractional key
+// from the frequencies of the keys returned by hz.
+//
+// TableHz interpolates like Table.Hz and is useful for
+// implementing KeyTuning with other storage.
+func TableHz(hz func(k int) float32, key float32) float32 {
+	k := int(math.Floor(float64(key)))
+	switch {
+	case k < 0:
+		k = 0
+	case k > 126:
+		k = 126
+	}
+	lo, hi := hz(k), hz(k+1)
+	x := float64(key) - float64(k)
+	switch {
+	case lo == 0 && hi == 0:
+		return 0
+	case lo == 0:
+		if x < .5 {
+			return 0
+		}
+		return hi
+	case hi == 0:
+		if x >= .5 {
+			return 0
+		}
+		return lo
+	}
+	return lo * float32(math.Pow(float64(hi/lo), x))
+}
+
+// tableKey returns the mapped key of t nearest in pitch to f.
+//
+// Ties are resolved toward the lower key.
+func tableKey(t KeyTuning, f float32) int {
+	best, dist := -1, 0.
+	for k := 0; k < 128; k++ {
+		hz := t.Hz(float32(k))
+		if hz == 0 {
+			continue
+		}
+		d := math.Abs(math.Log2(float64(f) / float64(hz)))
+		if best < 0 || d < dist {
+			best, dist = k, d
+		}
+	}
+	return best
+}
@@ -3,11 +3,22 @@ package midi
 import "math"
 
 // Tuning is an interface for a chromatic scale.
+//
+// Tunings which are not 12-tone equal temperament
+// should implement KeyTuning.
 type Tuning interface {
 	// A4Hz returns the frequency of the note A4.
 	A4Hz() float32
 }
 
+// KeyTuning is a tuning mapping each key to an arbitrary frequency.
+type KeyTuning interface {
+	Tuning
+
+	// Hz returns the frequency of the fractional midi key.
+	Hz(key float32) float32
+}
+
 // StdTuning is an A440 tuning.
 var StdTuning = stdTuning{}
 
@@ -27,10 +38,33 @@ func clampKey(k int) uint8 {
 	return uint8(k)
 }
 
-// Key returns the MIDI key value from tuning t and frequency f.
+// Key returns the MIDI key nearest to frequency f in tuning t.
 // A4 is MIDI key 69 for instance.
+//
+// For a KeyTuning the nearest mapped key is returned.
 func Key(t Tuning, f float32) int {
-	return int(69 + 12*math.Log2(float64(f)/float64(t.A4Hz())))
+	k, _ := KeyCents(t, f)
+	return k
+}
+
+// KeyCents returns the MIDI key nearest to frequency f in tuning t
+// and the offset of f from the key in cents.
+//
+// For a frequency f <= 0 or a KeyTuning without mapped keys
+// -1 is returned.
+func KeyCents(t Tuning, f float32) (key int, cents float32) {
+	if f <= 0 {
+		return -1, 0
+	}
+	if kt, ok := t.(KeyTuning); ok {
+		if key = tableKey(kt, f); key < 0 {
+			return -1, 0
+		}
+		return key, float32(1200 * math.Log2(float64(f)/float64(kt.Hz(float32(key)))))
+	}
+	semis := 69 + 12*math.Log2(float64(f)/float64(t.A4Hz()))
+	key = int(math.Round(semis))
+	return key, float32(100 * (semis - float64(key)))
 }
 
 // Pitch returns the pitch of the midi key in tuning t.
@@ -40,6 +74,9 @@ func Pitch(t Tuning, key int) float32 {
 
 // Tone returns the tone of the fractional midi key in tuning t.
 func Tone(t Tuning, key float32) float32 {
+	if kt, ok := t.(KeyTuning); ok {
+		return kt.Hz(key)
+	}
 	return t.A4Hz() * float32(math.Pow(2, (float64(key)-69)/12))
 }
 
@@ -26,16 +26,25 @@ type Config struct {
 
 	// Phase configures the phase shift value for supported modules.
 	Phase float32
+
+	// Transport configures the shared tempo and song position.
+	//
+	// Defaults to a stopped transport at 120 BPM in 4/4 following SampleRate.
+	// The host or a module such as a MIDI clock sync starts and advances it.
+	Transport *Transport
 }
 
 // New returns a new modular config with default values.
 func New() *Config {
-	return &Config{
+	cfg := &Config{
 		SampleRate:       44100,
 		BufferSize:       44100,
 		DriverBufferSize: 44100,
 		SampleSize:       512, // ~12ms
+		Transport:        NewTransport(44100),
 	}
+	cfg.Transport.SetConfig(cfg)
+	return cfg
 }
 
 // Processor is an interface for block processors.
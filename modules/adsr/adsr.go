@@ -105,6 +105,11 @@ func (a *ADSR) Release() {
 	}
 }
 
+// Done returns true when the release phase has completed.
+func (a *ADSR) Done() bool {
+	return a.phase == release && a.p >= a.end
+}
+
 func (a *ADSR) releaseNow() {
 	a.phase = release
 	a.begin = a.p
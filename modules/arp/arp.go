@@ -0,0 +1,302 @@
+// Package arp provides an arpeggiator for held MIDI notes.
+package arp
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/modules/clock"
+	"github.com/ajzaff/go-modular/modules/osc"
+)
+
+// Order controls the order held notes are played in.
+type Order int
+
+const (
+	Up       Order = iota // lowest to highest
+	Down                  // highest to lowest
+	UpDown                // lowest to highest and back
+	Random                // random notes
+	AsPlayed              // in the order pressed
+)
+
+type note struct {
+	key, vel uint8
+}
+
+// Arp is an arpeggiator outputting pitch CV and gates.
+//
+// Arp implements midi.NoteHandler from modules/midi and is safe to
+// feed notes from the MIDI reader goroutine.
+//
+// The arpeggiator is advanced by the clock if set or the internal tempo.
+type Arp struct {
+	mu      sync.Mutex
+	held    []note
+	latched []note
+	latch   bool
+	order   Order
+	octaves int
+	dirty   bool // pattern needs rebuilding
+
+	// Pattern owned by the audio goroutine.
+	buf     []note
+	notes   []note
+	current Order
+
+	length float32
+	clock  clock.Stepper
+
+	pos  int
+	play bool
+	key  int
+	vel  uint8
+	trig bool
+
+	rand osc.NoiseOsc
+}
+
+// New returns a new arpeggiator playing notes in order over the given number of octaves.
+func New(order Order, octaves int) *Arp {
+	a := &Arp{
+		order:   order,
+		octaves: octaves,
+		length:  .5,
+		clock:   clock.NewStepper(),
+		dirty:   true,
+		rand:    osc.NoiseOsc{State: osc.NoiseSeed, A: .5, C: .5},
+	}
+	a.Reset()
+	return a
+}
+
+func (a *Arp) SetConfig(cfg *modular.Config) error {
+	a.clock.SetConfig(cfg)
+	a.Reset()
+	return nil
+}
+
+// SetOrder sets the note order.
+func (a *Arp) SetOrder(o Order) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.order, a.dirty = o, true
+}
+
+// SetOctaves sets the number of octaves to play over.
+func (a *Arp) SetOctaves(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.octaves, a.dirty = n, true
+}
+
+// SetLength sets the gate length as a fraction of a step.
+//
+// The default is 0.5.
+func (a *Arp) SetLength(length float32) {
+	a.length = length
+}
+
+// SetLatch enables or disables latch mode.
+//
+// In latch mode notes keep playing after release until
+// a new note is pressed with no keys held.
+func (a *Arp) SetLatch(latch bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.latch, a.dirty = latch, true
+	if !latch {
+		a.latched = nil
+	}
+}
+
+// SetTempo sets the internal tempo as in clock.Stepper.SetTempo.
+func (a *Arp) SetTempo(bpm, stepsPerBeat float32) {
+	a.clock.SetTempo(bpm, stepsPerBeat)
+}
+
+// ResetClock unsets the clock input and uses the internal tempo.
+func (a *Arp) ResetClock() {
+	a.clock.ResetClock()
+}
+
+// SetClock sets the clock input.
+//
+//	clock will be called once per sample.
+//	A rising edge advances the arpeggiator.
+func (a *Arp) SetClock(clock func() bool) {
+	a.clock.SetClock(clock)
+}
+
+// Seed seeds the random source used by Random.
+//
+// A zero seed restores the default seed.
+func (a *Arp) Seed(seed uint32) {
+	a.rand.Seed(seed)
+}
+
+// NoteOn adds a held note.
+func (a *Arp) NoteOn(key, vel uint8) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.latch && len(a.held) == 0 {
+		a.latched = nil
+	}
+	for _, n := range a.held {
+		if n.key == key {
+			return
+		}
+	}
+	a.held = append(a.held, note{key, vel})
+	a.dirty = true
+	if a.latch {
+		a.latched = append(a.latched, note{key, vel})
+	}
+}
+
+// NoteOff releases a held note.
+func (a *Arp) NoteOff(key uint8) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, n := range a.held {
+		if n.key == key {
+			a.held = append(a.held[:i], a.held[i+1:]...)
+			a.dirty = true
+			return
+		}
+	}
+}
+
+// Clear releases all notes including latched notes.
+func (a *Arp) Clear() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.held = nil
+	a.latched = nil
+	a.dirty = true
+}
+
+// Reset restarts the pattern from the first note.
+func (a *Arp) Reset() {
+	a.pos = -1
+	a.play = false
+	a.trig = false
+	a.clock.Reset()
+}
+
+// pattern returns the notes in one cycle of the arpeggio.
+//
+// The pattern is rebuilt only when the held notes or settings change.
+func (a *Arp) pattern() []note {
+	a.mu.Lock()
+	if !a.dirty {
+		a.mu.Unlock()
+		return a.notes
+	}
+	notes := a.held
+	if a.latch {
+		notes = a.latched
+	}
+	a.buf = append(a.buf[:0], notes...)
+	order, octaves := a.order, a.octaves
+	a.dirty = false
+	a.mu.Unlock()
+
+	notes = a.buf
+	if order != AsPlayed {
+		sort.Slice(notes, func(i, j int) bool { return notes[i].key < notes[j].key })
+	}
+	if octaves < 1 {
+		octaves = 1
+	}
+	res := a.notes[:0]
+	for o := 0; o < octaves; o++ {
+		for _, n := range notes {
+			k := int(n.key) + 12*o
+			if k > 127 {
+				continue
+			}
+			res = append(res, note{uint8(k), n.vel})
+		}
+	}
+	switch order {
+	case Down:
+		for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+			res[i], res[j] = res[j], res[i]
+		}
+	case UpDown:
+		for i := len(res) - 2; i > 0; i-- {
+			res = append(res, res[i])
+		}
+	}
+	a.notes, a.current = res, order
+	return res
+}
+
+func (a *Arp) advance() {
+	notes := a.pattern()
+	if len(notes) == 0 {
+		a.play = false
+		a.pos = -1
+		return
+	}
+	if a.current == Random {
+		a.pos = int(a.rand.Next() * float32(len(notes)))
+		if a.pos >= len(notes) {
+			a.pos = len(notes) - 1
+		}
+	} else {
+		a.pos = (a.pos + 1) % len(notes)
+	}
+	n := notes[a.pos]
+	a.key, a.vel = int(n.key), n.vel
+	a.play = true
+	a.trig = true
+}
+
+// Next advances the arpeggiator one sample and returns the pitch CV.
+func (a *Arp) Next() float32 {
+	a.trig = false
+	if a.clock.Next() {
+		a.advance()
+	}
+	return a.Voltage()
+}
+
+// Key returns the midi key of the last played note.
+func (a *Arp) Key() int {
+	return a.key
+}
+
+// Vel returns the velocity of the last played note in the range 0 to 1.
+func (a *Arp) Vel() float32 {
+	return float32(a.vel) / 127
+}
+
+// Voltage returns the pitch CV of the last played note.
+//
+// Voltage uses the one-volt-per-octave standard compatible with osc.Osc.Voltage.
+func (a *Arp) Voltage() float32 {
+	return float32(a.key) / 12
+}
+
+// Gate returns true while the gate of the current note is open.
+func (a *Arp) Gate() bool {
+	return a.play && a.clock.Gate(a.length)
+}
+
+// Trig returns true on the first sample of each played note.
+//
+// Trig only reports the sample of the last call to Next;
+// after Process it reflects the last sample of the block.
+func (a *Arp) Trig() bool {
+	return a.trig
+}
+
+// Process fills the block with pitch CV.
+func (a *Arp) Process(b []float32) {
+	for i := range b {
+		b[i] = a.Next()
+	}
+}
@@ -0,0 +1,70 @@
+package arp
+
+import "testing"
+
+// clocked returns an arpeggiator holding keys and advanced by a clock
+// with a rising edge on every other sample.
+func clocked(order Order, keys ...uint8) *Arp {
+	a := New(order, 1)
+	for _, k := range keys {
+		a.NoteOn(k, 100)
+	}
+	on := false
+	a.SetClock(func() bool {
+		on = !on
+		return on
+	})
+	return a
+}
+
+func TestOrder(t *testing.T) {
+	for _, tc := range []struct {
+		order Order
+		want  []int
+	}{
+		{Up, []int{60, 64, 67, 60}},
+		{Down, []int{67, 64, 60, 67}},
+		{UpDown, []int{60, 64, 67, 64, 60}},
+		{AsPlayed, []int{64, 60, 67, 64}},
+	} {
+		a := clocked(tc.order, 64, 60, 67)
+		for i, want := range tc.want {
+			a.Next()
+			if !a.Trig() || a.Key() != want {
+				t.Errorf("order %d step %d: got key %d trig %v, want %d", tc.order, i, a.Key(), a.Trig(), want)
+			}
+			a.Next()
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	a := clocked(Random, 60, 62, 64, 65)
+	count := map[int]int{}
+	for i := 0; i < 200; i++ {
+		a.Next()
+		count[a.Key()]++
+		a.Next()
+	}
+	for _, k := range []int{60, 62, 64, 65} {
+		if c := count[k]; c < 25 || c > 75 {
+			t.Errorf("key %d played %d times out of 200", k, c)
+		}
+	}
+}
+
+func TestGate(t *testing.T) {
+	a := New(Up, 1)
+	a.SetTempo(60, 1) // one step per second
+	a.NoteOn(60, 100)
+	open := 0
+	for i := 0; i < 44100; i++ {
+		a.Next()
+		if a.Gate() {
+			open++
+		}
+	}
+	if open != 44100/2 {
+		t.Errorf("got gate open %d samples, want %d", open, 44100/2)
+	}
+}
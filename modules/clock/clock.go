@@ -0,0 +1,207 @@
+// Package clock provides a master clock with divided and multiplied outputs.
+package clock
+
+import (
+	"math"
+
+	"github.com/ajzaff/go-modular"
+)
+
+// Rate is a clock rate in triggers per beat.
+type Rate float64
+
+// Rate constants in 4/4.
+const (
+	Whole     Rate = 1. / 4
+	Half      Rate = 1. / 2
+	Quarter   Rate = 1
+	Eighth    Rate = 2
+	Sixteenth Rate = 4
+)
+
+// Div returns the rate of one trigger every n beats.
+func Div(n int) Rate {
+	return Rate(1 / float64(n))
+}
+
+// Mult returns the rate of n triggers per beat.
+func Mult(n int) Rate {
+	return Rate(n)
+}
+
+// Triplet returns the rate of triplets of r.
+func (r Rate) Triplet() Rate {
+	return r * 3 / 2
+}
+
+// Dotted returns the rate of dotted r.
+func (r Rate) Dotted() Rate {
+	return r * 2 / 3
+}
+
+// Output is a clock output.
+type Output struct {
+	// Rate is the output rate.
+	Rate Rate
+
+	// Swing delays every other trigger by a fraction of the trigger period.
+	//
+	// Zero is straight and values approaching 1 delay the
+	// offbeat until the next downbeat.
+	Swing float32
+
+	last int64
+	trig bool
+	gate bool
+}
+
+// Trig returns true on the first sample of each clock period.
+//
+// Outputs are updated by Clock.Next one sample at a time, so Trig
+// should be read between calls to Next rather than after Process.
+func (o *Output) Trig() bool {
+	return o.trig
+}
+
+// Gate returns true for the first half of each clock period.
+func (o *Output) Gate() bool {
+	return o.gate
+}
+
+func (o *Output) reset() {
+	o.last = math.MinInt64
+	o.trig, o.gate = false, false
+}
+
+func (o *Output) update(beats float64, playing bool) {
+	if !playing || o.Rate <= 0 {
+		o.trig, o.gate = false, false
+		return
+	}
+	swing := math.Min(math.Max(float64(o.Swing), 0), .99)
+	pairs := beats * float64(o.Rate) / 2
+	pair := math.Floor(pairs)
+	f := pairs - pair
+	mid := (1 + swing) / 2
+	k, start, length := int64(pair)*2, 0., mid
+	if f >= mid {
+		k, start, length = k+1, mid, 1-mid
+	}
+	o.trig = k != o.last
+	o.last = k
+	o.gate = f-start < length/2
+}
+
+// Clock is a master clock following a transport.
+//
+// The clock runs and advances its own transport unless SetTransport
+// shares another, such as the Config Transport.
+type Clock struct {
+	transport *modular.Transport
+	local     *modular.Transport
+
+	base float64
+	tpos int64
+	n    int
+
+	beat *Output
+	outs []*Output
+}
+
+// New returns a new running clock triggering each beat.
+func New() *Clock {
+	c := &Clock{beat: &Output{Rate: Quarter}, local: modular.NewTransport(44100)}
+	c.local.Start()
+	c.SetTransport(nil)
+	return c
+}
+
+func (c *Clock) SetConfig(cfg *modular.Config) error {
+	c.local.SetConfig(cfg)
+	c.Reset()
+	return nil
+}
+
+// SetTransport makes the clock follow the shared transport t.
+//
+// The shared transport is started and advanced by its owner.
+// A nil transport restores the running transport of the clock.
+func (c *Clock) SetTransport(t *modular.Transport) {
+	if t == nil {
+		t = c.local
+	}
+	c.transport = t
+	c.base, c.tpos, c.n = t.Beats(), t.Pos(), 0
+	c.Reset()
+}
+
+// Transport returns the transport followed by the clock.
+func (c *Clock) Transport() *modular.Transport {
+	return c.transport
+}
+
+// Out adds a new output at rate r with the given swing.
+func (c *Clock) Out(r Rate, swing float32) *Output {
+	o := &Output{Rate: r, Swing: swing}
+	o.reset()
+	c.outs = append(c.outs, o)
+	return o
+}
+
+// Reset retriggers all outputs on the next sample.
+func (c *Clock) Reset() {
+	c.beat.reset()
+	for _, o := range c.outs {
+		o.reset()
+	}
+}
+
+// Beats returns the clock position in beats.
+func (c *Clock) Beats() float64 {
+	t := c.transport
+	if t.Pos() != c.tpos || t.Beats() != c.base {
+		c.base, c.tpos, c.n = t.Beats(), t.Pos(), 0
+	}
+	if s := t.BeatSamples(); s > 0 {
+		return c.base + float64(c.n)/s
+	}
+	return c.base
+}
+
+// Trig returns true on the first sample of each beat.
+func (c *Clock) Trig() bool {
+	return c.beat.trig
+}
+
+// Gate returns true for the first half of each beat.
+func (c *Clock) Gate() bool {
+	return c.beat.gate
+}
+
+// Next advances the clock one sample and updates all outputs.
+//
+// Next returns 1 on the first sample of each beat and 0 otherwise.
+func (c *Clock) Next() float32 {
+	beats := c.Beats()
+	playing := c.transport.Playing()
+	c.beat.update(beats, playing)
+	for _, o := range c.outs {
+		o.update(beats, playing)
+	}
+	if c.transport == c.local {
+		c.transport.Advance(1)
+	} else if playing {
+		c.n++
+	}
+	if c.beat.trig {
+		return 1
+	}
+	return 0
+}
+
+// Process fills the block with beat triggers.
+func (c *Clock) Process(b []float32) {
+	for i := range b {
+		b[i] = c.Next()
+	}
+}
@@ -0,0 +1,128 @@
+package clock
+
+import (
+	"math"
+
+	"github.com/ajzaff/go-modular"
+)
+
+// Stepper advances a sequencer in steps from a clock input or an internal tempo.
+//
+// It also measures the step period so gates can be a fraction of a step.
+// The zero value is not ready for use; use NewStepper.
+type Stepper struct {
+	clock      func() bool
+	clockOn    bool
+	bpm        float32
+	div        float32
+	tempoSet   bool
+	transport  *modular.Transport
+	sampleRate int
+	phase      float64
+
+	started bool
+	n       int // samples since the last step
+	period  int // samples between the last two steps
+}
+
+// NewStepper returns a stepper at 120 BPM with 4 steps per beat.
+func NewStepper() Stepper {
+	s := Stepper{bpm: 120, div: 4, sampleRate: 44100}
+	s.Reset()
+	return s
+}
+
+// SetConfig follows the sample rate and the tempo of the Config Transport
+// and resets the stepper.
+func (s *Stepper) SetConfig(cfg *modular.Config) {
+	s.sampleRate = cfg.SampleRate
+	s.transport = cfg.Transport
+	s.Reset()
+}
+
+// SetTempo sets the internal tempo in beats per minute and steps per beat.
+//
+// The default is the tempo of the Config Transport or 120 BPM with 4 steps per beat.
+// A zero bpm keeps following the Config Transport.
+func (s *Stepper) SetTempo(bpm, stepsPerBeat float32) {
+	s.bpm, s.div, s.tempoSet = bpm, stepsPerBeat, bpm != 0
+}
+
+// ResetClock unsets the clock input and uses the internal tempo.
+func (s *Stepper) ResetClock() {
+	s.clock = nil
+}
+
+// SetClock sets the clock input.
+//
+//	clock will be called once per sample.
+//	A rising edge advances a step.
+func (s *Stepper) SetClock(clock func() bool) {
+	s.clock = clock
+}
+
+// Reset makes the next sample a step.
+//
+// With the internal tempo the step period restarts from the tempo.
+func (s *Stepper) Reset() {
+	s.started = false
+	s.phase = 1
+	s.n = 0
+	if r := s.rate(); r > 0 {
+		s.period = int(1 / r)
+	}
+}
+
+// rate returns the internal clock rate in steps per sample.
+func (s *Stepper) rate() float64 {
+	bpm := s.bpm
+	if !s.tempoSet && s.transport != nil {
+		bpm = float32(s.transport.Tempo())
+	}
+	if bpm <= 0 || s.div <= 0 || s.sampleRate <= 0 {
+		return 0
+	}
+	return float64(bpm*s.div) / (60 * float64(s.sampleRate))
+}
+
+func (s *Stepper) tick() bool {
+	if s.clock != nil {
+		on := s.clock()
+		edge := on && !s.clockOn
+		s.clockOn = on
+		return edge
+	}
+	r := s.rate()
+	if r <= 0 {
+		return false
+	}
+	tick := s.phase >= 1
+	if tick {
+		s.phase -= math.Floor(s.phase)
+	}
+	s.phase += r
+	return tick
+}
+
+// Next advances the stepper one sample and returns true on the first sample of a step.
+func (s *Stepper) Next() bool {
+	s.n++
+	if !s.tick() {
+		return false
+	}
+	if s.started {
+		s.period = s.n
+	} else if r := s.rate(); r > 0 {
+		// The first step has the period of the tempo.
+		s.period = int(1 / r)
+	}
+	s.started, s.n = true, 0
+	return true
+}
+
+// Gate returns true while a gate of length steps is open.
+//
+// A length of 1 or more stays open for the whole step.
+func (s *Stepper) Gate(length float32) bool {
+	return length >= 1 || float32(s.n) < length*float32(s.period)
+}
@@ -0,0 +1,334 @@
+// Package envelope provides a multi-stage breakpoint envelope generator.
+package envelope
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/ajzaff/go-modular"
+)
+
+// Breakpoint is a single envelope stage.
+//
+// The envelope moves from the level of the previous breakpoint
+// (or the current level for the first) to Level over Time.
+type Breakpoint struct {
+	// Time is the duration of the stage.
+	Time time.Duration `json:"time"`
+
+	// Beats optionally overrides Time with a tempo-synced duration
+	// when positive. See SetTempo.
+	Beats float32 `json:"beats,omitempty"`
+
+	// Level is the level reached at the end of the stage.
+	Level float32 `json:"level"`
+
+	// Curve shapes the stage.
+	//
+	// Zero is linear, positive values start slow (exponential)
+	// and negative values start fast (logarithmic).
+	Curve float32 `json:"curve,omitempty"`
+}
+
+// Envelope is a breakpoint envelope generator.
+//
+// It supports an optional sustain point and an optional loop
+// which repeats while the envelope is not released.
+type Envelope struct {
+	points    []Breakpoint
+	sustain   int
+	loopStart int
+	loopEnd   int
+	bpm       float32
+	tempoSet  bool
+	transport *modular.Transport
+
+	seg      int
+	from     float32
+	level    float32
+	p, n     int
+	released bool
+
+	gate   func() bool
+	gateOn bool
+
+	sampleRate int
+}
+
+// New returns a new envelope with the given breakpoints.
+//
+// Example DAHDSR:
+//
+//	e := New(
+//		Breakpoint{Time: delay},
+//		Breakpoint{Time: attack, Level: 1},
+//		Breakpoint{Time: hold, Level: 1},
+//		Breakpoint{Time: decay, Level: sustain},
+//		Breakpoint{Time: release},
+//	)
+//	e.SetSustain(3)
+func New(points ...Breakpoint) *Envelope {
+	e := &Envelope{
+		points:     points,
+		sustain:    -1,
+		loopStart:  -1,
+		loopEnd:    -1,
+		bpm:        120,
+		sampleRate: 44100,
+	}
+	e.Reset()
+	return e
+}
+
+func (e *Envelope) SetConfig(cfg *modular.Config) error {
+	e.sampleRate = cfg.SampleRate
+	e.transport = cfg.Transport
+	e.Reset()
+	return nil
+}
+
+// Points returns the breakpoints of the envelope.
+//
+// The envelope must not be modified through the returned slice.
+func (e *Envelope) Points() []Breakpoint {
+	return e.points
+}
+
+// SetSustain sets the sustain point to the breakpoint at index i.
+//
+// The envelope holds the level of point i until released.
+func (e *Envelope) SetSustain(i int) {
+	if i < 0 || i >= len(e.points) {
+		panic("envelope.Envelope.SetSustain: sustain point out of range")
+	}
+	e.sustain = i
+}
+
+// ResetSustain clears the sustain point.
+func (e *Envelope) ResetSustain() {
+	e.sustain = -1
+}
+
+// SetLoop sets the loop points.
+//
+// Upon reaching breakpoint end the envelope restarts from the level of
+// breakpoint start and continues with the stage after it until released.
+func (e *Envelope) SetLoop(start, end int) {
+	if start < 0 || end >= len(e.points) || start >= end {
+		panic("envelope.Envelope.SetLoop: invalid loop points")
+	}
+	e.loopStart, e.loopEnd = start, end
+}
+
+// ResetLoop clears the loop points.
+func (e *Envelope) ResetLoop() {
+	e.loopStart, e.loopEnd = -1, -1
+}
+
+// SetTempo sets the tempo used for breakpoints with Beats set.
+//
+// The default tempo is that of the Config Transport or 120 BPM.
+// Changes apply from the next stage.
+func (e *Envelope) SetTempo(bpm float32) {
+	e.bpm, e.tempoSet = bpm, true
+}
+
+func (e *Envelope) tempo() float32 {
+	if !e.tempoSet && e.transport != nil {
+		return float32(e.transport.Tempo())
+	}
+	return e.bpm
+}
+
+// ResetGate unsets the automatic gate.
+func (e *Envelope) ResetGate() {
+	e.gate = nil
+}
+
+// SetGate sets the automatic gate.
+//
+//	gate will be called once per sample.
+//	A rising edge resets the envelope and a falling edge releases it.
+func (e *Envelope) SetGate(gate func() bool) {
+	e.gate = gate
+}
+
+func (e *Envelope) samples(b Breakpoint) int {
+	d := b.Time.Seconds()
+	if bpm := e.tempo(); b.Beats > 0 && bpm > 0 {
+		d = 60 * float64(b.Beats) / float64(bpm)
+	}
+	return int(math.Round(float64(e.sampleRate) * d))
+}
+
+func (e *Envelope) enter(seg int) {
+	e.seg = seg
+	e.from = e.level
+	e.p = 0
+	e.n = 0
+	if seg < len(e.points) {
+		e.n = e.samples(e.points[seg])
+	}
+}
+
+// Reset manually resets the envelope to the first stage.
+//
+// The first stage begins at the current level to avoid clicks.
+func (e *Envelope) Reset() {
+	e.released = false
+	e.enter(0)
+}
+
+// Release releases the envelope now.
+//
+// The envelope skips to the stage after the sustain point if set,
+// otherwise it stops looping.
+func (e *Envelope) Release() {
+	if e.released {
+		return
+	}
+	e.released = true
+	if e.sustain >= 0 && e.seg <= e.sustain {
+		e.enter(e.sustain + 1)
+	}
+}
+
+// Done returns true when the final stage has completed.
+func (e *Envelope) Done() bool {
+	return e.seg >= len(e.points)
+}
+
+func shape(c, t float32) float32 {
+	if c == 0 {
+		return t
+	}
+	return float32(math.Expm1(float64(c*t)) / math.Expm1(float64(c)))
+}
+
+// Envelope returns the next envelope level.
+//
+// Envelope calls mutate the envelope.
+func (e *Envelope) Envelope() float32 {
+	// Bound the stages visited per sample in case every looped stage is empty.
+	for i := 0; e.seg < len(e.points) && e.p >= e.n; i++ {
+		e.level = e.points[e.seg].Level
+		if i > len(e.points) {
+			return e.level
+		}
+		if !e.released {
+			if e.seg == e.loopEnd {
+				e.level = e.points[e.loopStart].Level
+				e.enter(e.loopStart + 1)
+				continue
+			}
+			if e.seg == e.sustain {
+				return e.level
+			}
+		}
+		e.enter(e.seg + 1)
+	}
+	if e.seg >= len(e.points) {
+		return e.level
+	}
+	b := e.points[e.seg]
+	e.level = e.from + (b.Level-e.from)*shape(b.Curve, float32(e.p)/float32(e.n))
+	e.p++
+	return e.level
+}
+
+func (e *Envelope) updateGate() {
+	if e.gate == nil {
+		return
+	}
+	on := e.gate()
+	if on && !e.gateOn {
+		e.Reset()
+	} else if !on && e.gateOn {
+		e.Release()
+	}
+	e.gateOn = on
+}
+
+// Next returns the next envelope level after updating the gate.
+func (e *Envelope) Next() float32 {
+	e.updateGate()
+	return e.Envelope()
+}
+
+// Process convolves the block with the envelope.
+func (e *Envelope) Process(b []float32) {
+	for i, v := range b {
+		b[i] = v * e.Next()
+	}
+}
+
+type definition struct {
+	Points    []Breakpoint `json:"points"`
+	Sustain   int          `json:"sustain"`
+	LoopStart int          `json:"loopStart"`
+	LoopEnd   int          `json:"loopEnd"`
+	Tempo     float32      `json:"tempo,omitempty"`
+}
+
+// MarshalJSON encodes the breakpoint definition of the envelope.
+//
+// The tempo is included when set with SetTempo.
+func (e *Envelope) MarshalJSON() ([]byte, error) {
+	def := definition{
+		Points:    e.points,
+		Sustain:   e.sustain,
+		LoopStart: e.loopStart,
+		LoopEnd:   e.loopEnd,
+	}
+	if e.tempoSet {
+		def.Tempo = e.bpm
+	}
+	return json.Marshal(def)
+}
+
+// UnmarshalJSON decodes a breakpoint definition into the envelope.
+func (e *Envelope) UnmarshalJSON(data []byte) error {
+	def := definition{Sustain: -1, LoopStart: -1, LoopEnd: -1}
+	if err := json.Unmarshal(data, &def); err != nil {
+		return fmt.Errorf("envelope.Envelope.UnmarshalJSON: %v", err)
+	}
+	if def.Sustain < -1 || def.Sustain >= len(def.Points) {
+		return fmt.Errorf("envelope.Envelope.UnmarshalJSON: sustain point out of range")
+	}
+	if (def.LoopStart != -1 || def.LoopEnd != -1) &&
+		(def.LoopStart < 0 || def.LoopEnd >= len(def.Points) || def.LoopStart >= def.LoopEnd) {
+		return fmt.Errorf("envelope.Envelope.UnmarshalJSON: invalid loop points")
+	}
+	if def.Tempo < 0 {
+		return fmt.Errorf("envelope.Envelope.UnmarshalJSON: negative tempo")
+	}
+	e.points = def.Points
+	e.sustain = def.Sustain
+	e.loopStart, e.loopEnd = def.LoopStart, def.LoopEnd
+	e.bpm, e.tempoSet = def.Tempo, def.Tempo > 0
+	if !e.tempoSet {
+		e.bpm = 120
+	}
+	if e.sampleRate == 0 {
+		e.sampleRate = 44100
+	}
+	e.Reset()
+	return nil
+}
+
+// Save writes the breakpoint definition to w as JSON.
+func (e *Envelope) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(e)
+}
+
+// Load reads a breakpoint definition from r as written by Save.
+func Load(r io.Reader) (*Envelope, error) {
+	e := New()
+	if err := json.NewDecoder(r).Decode(e); err != nil {
+		return nil, fmt.Errorf("envelope.Load: %v", err)
+	}
+	return e, nil
+}
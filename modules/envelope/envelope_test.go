@@ -0,0 +1,102 @@
+package envelope
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ajzaff/go-modular"
+)
+
+// newTestEnvelope returns an envelope at 1000 samples per second.
+func newTestEnvelope(points ...Breakpoint) *Envelope {
+	e := New(points...)
+	e.SetConfig(&modular.Config{SampleRate: 1000})
+	return e
+}
+
+func TestEnvelope(t *testing.T) {
+	e := newTestEnvelope(
+		Breakpoint{Time: 2 * time.Millisecond, Level: 1},
+		Breakpoint{Time: 2 * time.Millisecond, Level: .5},
+		Breakpoint{Time: 2 * time.Millisecond},
+	)
+	e.SetSustain(1)
+	var got []float32
+	for i := 0; i < 6; i++ {
+		got = append(got, e.Envelope())
+	}
+	e.Release()
+	for i := 0; i < 3; i++ {
+		got = append(got, e.Envelope())
+	}
+	want := []float32{0, .5, 1, .75, .5, .5, .5, .25, 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got levels %v, want %v", got, want)
+	}
+	if !e.Done() {
+		t.Errorf("envelope not done after the release stage")
+	}
+}
+
+func TestLoop(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		start, end int
+		want       []float32
+	}{
+		{"two stages", 0, 2, []float32{.5, .75, 1, .75, .5, .75, 1, .75, .5, .75}},
+		{"one stage", 1, 2, []float32{.5, .75, 1, .75, 1, .75, 1, .75, 1, .75}},
+	} {
+		e := newTestEnvelope(
+			Breakpoint{Time: 2 * time.Millisecond, Level: .5},
+			Breakpoint{Time: 2 * time.Millisecond, Level: 1},
+			Breakpoint{Time: 2 * time.Millisecond, Level: .5},
+		)
+		e.SetLoop(tc.start, tc.end)
+		// Skip the first stage.
+		e.Envelope()
+		e.Envelope()
+		var got []float32
+		for i := 0; i < 10; i++ {
+			got = append(got, e.Envelope())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got levels %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	e := New(
+		Breakpoint{Beats: 1, Level: 1},
+		Breakpoint{Time: time.Second, Level: .5, Curve: 2},
+		Breakpoint{Time: time.Second},
+	)
+	e.SetSustain(1)
+	e.SetLoop(0, 1)
+	e.SetTempo(90)
+	e.Reset()
+	var buf bytes.Buffer
+	if err := e.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, e) {
+		t.Errorf("Load(Save(e)) = %+v, want %+v", got, e)
+	}
+
+	for _, in := range []string{
+		`{"points":[{"time":0}],"sustain":1}`,
+		`{"points":[{"time":0},{"time":0}],"loopStart":1,"loopEnd":1}`,
+		`{"points":[{"time":0}],"tempo":-1}`,
+	} {
+		if _, err := Load(bytes.NewBufferString(in)); err == nil {
+			t.Errorf("Load(%s): want error", in)
+		}
+	}
+}
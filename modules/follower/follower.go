@@ -0,0 +1,153 @@
+// Package follower converts audio signals into control voltages.
+package follower
+
+import (
+	"math"
+	"time"
+
+	"github.com/ajzaff/go-modular"
+)
+
+// Mode selects the envelope detector.
+type Mode int
+
+const (
+	Peak Mode = iota // rectified peak level
+	RMS              // root mean square level
+)
+
+// Follower is an envelope follower.
+//
+// Process replaces the audio block with its amplitude envelope.
+type Follower struct {
+	mode       Mode
+	attack     time.Duration
+	release    time.Duration
+	ga, gr     float64
+	env        float64
+	sampleRate int
+}
+
+// New returns a new envelope follower with the given detector mode
+// and attack and release times.
+func New(mode Mode, attack, release time.Duration) *Follower {
+	f := &Follower{
+		mode:       mode,
+		attack:     attack,
+		release:    release,
+		sampleRate: 44100,
+	}
+	f.update()
+	return f
+}
+
+func (f *Follower) SetConfig(cfg *modular.Config) error {
+	f.sampleRate = cfg.SampleRate
+	f.update()
+	return nil
+}
+
+// coeff returns the one-pole smoothing coefficient for time constant d.
+func coeff(d time.Duration, sampleRate int) float64 {
+	n := d.Seconds() * float64(sampleRate)
+	if n <= 0 {
+		return 0
+	}
+	return math.Exp(-1 / n)
+}
+
+func (f *Follower) update() {
+	f.ga = coeff(f.attack, f.sampleRate)
+	f.gr = coeff(f.release, f.sampleRate)
+}
+
+// SetAttack sets the attack time.
+func (f *Follower) SetAttack(d time.Duration) {
+	f.attack = d
+	f.update()
+}
+
+// SetRelease sets the release time.
+func (f *Follower) SetRelease(d time.Duration) {
+	f.release = d
+	f.update()
+}
+
+// Reset clears the envelope.
+func (f *Follower) Reset() {
+	f.env = 0
+}
+
+// Value returns the current envelope level.
+func (f *Follower) Value() float32 {
+	if f.mode == RMS {
+		return float32(math.Sqrt(f.env))
+	}
+	return float32(f.env)
+}
+
+// Next returns the envelope level after the input sample v.
+func (f *Follower) Next(v float32) float32 {
+	x := math.Abs(float64(v))
+	if f.mode == RMS {
+		x *= x
+	}
+	g := f.gr
+	if x > f.env {
+		g = f.ga
+	}
+	f.env = g*f.env + (1-g)*x
+	return f.Value()
+}
+
+// Process replaces the audio block with the envelope CV.
+func (f *Follower) Process(b []float32) {
+	for i, v := range b {
+		b[i] = f.Next(v)
+	}
+}
+
+// Gate extracts a gate signal from a CV.
+//
+// The gate opens when the CV reaches the threshold and closes
+// when it falls below the threshold minus the hysteresis.
+type Gate struct {
+	Threshold  float32
+	Hysteresis float32
+
+	on bool
+}
+
+// NewGate returns a new gate extractor.
+func NewGate(threshold, hysteresis float32) *Gate {
+	return &Gate{Threshold: threshold, Hysteresis: hysteresis}
+}
+
+func (*Gate) SetConfig(*modular.Config) error { return nil }
+
+// On returns true while the gate is open.
+//
+// On is suitable for envelope.Envelope.SetGate.
+func (g *Gate) On() bool {
+	return g.on
+}
+
+// Next returns 1 if the gate is open after the input v and 0 otherwise.
+func (g *Gate) Next(v float32) float32 {
+	if g.on {
+		g.on = v >= g.Threshold-g.Hysteresis
+	} else {
+		g.on = v >= g.Threshold
+	}
+	if g.on {
+		return 1
+	}
+	return 0
+}
+
+// Process replaces the CV block with the gate signal.
+func (g *Gate) Process(b []float32) {
+	for i, v := range b {
+		b[i] = g.Next(v)
+	}
+}
@@ -0,0 +1,274 @@
+// Package logic provides comparators and gate logic on block buffers.
+//
+// Gate samples are high when positive and outputs are 0 or 1.
+package logic
+
+import (
+	"math"
+	"time"
+
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/modules/follower"
+)
+
+func bit(v bool) float32 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func checkLen(op string, dst, src []float32) {
+	if len(dst) != len(src) {
+		panic("logic." + op + ": slices must have equal length")
+	}
+}
+
+// And stores dst AND src into dst.
+func And(dst, src []float32) {
+	checkLen("And", dst, src)
+	for i, v := range src {
+		dst[i] = bit(dst[i] > 0 && v > 0)
+	}
+}
+
+// Or stores dst OR src into dst.
+func Or(dst, src []float32) {
+	checkLen("Or", dst, src)
+	for i, v := range src {
+		dst[i] = bit(dst[i] > 0 || v > 0)
+	}
+}
+
+// Xor stores dst XOR src into dst.
+func Xor(dst, src []float32) {
+	checkLen("Xor", dst, src)
+	for i, v := range src {
+		dst[i] = bit((dst[i] > 0) != (v > 0))
+	}
+}
+
+// Not inverts the gates in b.
+func Not(b []float32) {
+	for i, v := range b {
+		b[i] = bit(v <= 0)
+	}
+}
+
+// Comparator outputs a gate while the CV is at or above a threshold.
+//
+// The gate opens when the CV reaches the threshold and closes
+// when it falls below the threshold minus the hysteresis.
+// Comparator is the gate extractor of package follower.
+type Comparator = follower.Gate
+
+// NewComparator returns a new comparator.
+func NewComparator(threshold, hysteresis float32) *Comparator {
+	return follower.NewGate(threshold, hysteresis)
+}
+
+func samples(d time.Duration, sampleRate int) int {
+	return int(math.Round(float64(sampleRate) * d.Seconds()))
+}
+
+// Gate converts triggers into gates of fixed length.
+//
+// A rising edge opens the gate for the gate length.
+// Triggers while the gate is open restart it.
+type Gate struct {
+	length time.Duration
+
+	n          int
+	p          int
+	in         bool
+	sampleRate int
+}
+
+// NewGate returns a new trigger to gate converter with gate length d.
+func NewGate(d time.Duration) *Gate {
+	g := &Gate{length: d, sampleRate: 44100}
+	g.n = samples(d, g.sampleRate)
+	g.p = g.n
+	return g
+}
+
+func (g *Gate) SetConfig(cfg *modular.Config) error {
+	g.sampleRate = cfg.SampleRate
+	g.n = samples(g.length, g.sampleRate)
+	g.p = g.n
+	return nil
+}
+
+// SetLength sets the gate length.
+func (g *Gate) SetLength(d time.Duration) {
+	g.length = d
+	g.n = samples(d, g.sampleRate)
+}
+
+// On returns true while the gate is open.
+func (g *Gate) On() bool {
+	return g.p < g.n
+}
+
+// Next returns the gate for the trigger sample v.
+func (g *Gate) Next(v float32) float32 {
+	in := v > 0
+	if in && !g.in {
+		g.p = 0
+	} else if g.p < g.n {
+		g.p++
+	}
+	g.in = in
+	return bit(g.p < g.n)
+}
+
+// Process replaces the trigger block with the gates.
+func (g *Gate) Process(b []float32) {
+	for i, v := range b {
+		b[i] = g.Next(v)
+	}
+}
+
+// Delay delays a gate signal.
+type Delay struct {
+	delay time.Duration
+
+	buf        []bool
+	p          int
+	sampleRate int
+}
+
+// NewDelay returns a new gate delay of duration d.
+func NewDelay(d time.Duration) *Delay {
+	x := &Delay{delay: d, sampleRate: 44100}
+	x.Reset()
+	return x
+}
+
+func (x *Delay) SetConfig(cfg *modular.Config) error {
+	x.sampleRate = cfg.SampleRate
+	x.Reset()
+	return nil
+}
+
+// SetDelay sets the delay and clears the delay line.
+func (x *Delay) SetDelay(d time.Duration) {
+	x.delay = d
+	x.Reset()
+}
+
+// Reset clears the delay line.
+func (x *Delay) Reset() {
+	x.buf = make([]bool, samples(x.delay, x.sampleRate))
+	x.p = 0
+}
+
+// Next returns the delayed gate for the gate sample v.
+func (x *Delay) Next(v float32) float32 {
+	if len(x.buf) == 0 {
+		return bit(v > 0)
+	}
+	out := x.buf[x.p]
+	x.buf[x.p] = v > 0
+	x.p = (x.p + 1) % len(x.buf)
+	return bit(out)
+}
+
+// Process replaces the gate block with the delayed gates.
+func (x *Delay) Process(b []float32) {
+	for i, v := range b {
+		b[i] = x.Next(v)
+	}
+}
+
+// FlipFlop is a toggle flip-flop.
+//
+// Each rising edge toggles the output.
+type FlipFlop struct {
+	in, q bool
+}
+
+func (*FlipFlop) SetConfig(*modular.Config) error { return nil }
+
+// Reset clears the output.
+func (f *FlipFlop) Reset() {
+	f.q = false
+}
+
+// On returns true while the output is high.
+func (f *FlipFlop) On() bool {
+	return f.q
+}
+
+// Next returns the output for the trigger sample v.
+func (f *FlipFlop) Next(v float32) float32 {
+	in := v > 0
+	if in && !f.in {
+		f.q = !f.q
+	}
+	f.in = in
+	return bit(f.q)
+}
+
+// Process replaces the trigger block with the flip-flop output.
+func (f *FlipFlop) Process(b []float32) {
+	for i, v := range b {
+		b[i] = f.Next(v)
+	}
+}
+
+// Counter counts rising edges modulo N.
+//
+// The output passes the input gate through when the count wraps,
+// dividing the input by N.
+type Counter struct {
+	// N is the count modulus.
+	N int
+
+	count int
+	in    bool
+	out   bool
+}
+
+// NewCounter returns a new counter modulo n.
+func NewCounter(n int) *Counter {
+	return &Counter{N: n, count: -1}
+}
+
+func (*Counter) SetConfig(*modular.Config) error { return nil }
+
+// Reset restarts the count so the next edge counts 0.
+func (c *Counter) Reset() {
+	c.count = -1
+}
+
+// Count returns the current count.
+func (c *Counter) Count() int {
+	return c.count
+}
+
+// On returns true while the output is high.
+func (c *Counter) On() bool {
+	return c.out
+}
+
+// Next returns the output for the gate sample v.
+func (c *Counter) Next(v float32) float32 {
+	in := v > 0
+	if in && !c.in {
+		c.count++
+		if c.N > 0 {
+			c.count %= c.N
+		}
+	}
+	c.in = in
+	c.out = in && c.count == 0
+	return bit(c.out)
+}
+
+// Process replaces the gate block with the counter output.
+func (c *Counter) Process(b []float32) {
+	for i, v := range b {
+		b[i] = c.Next(v)
+	}
+}
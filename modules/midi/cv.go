@@ -0,0 +1,109 @@
+package midi
+
+import "github.com/ajzaff/go-modular"
+
+// cvProcessor fills blocks with a MIDI CV from its own copy of the
+// interface state, applying queued events at their sample offsets.
+type cvProcessor struct {
+	iface   *Interface
+	n       int64
+	init    bool
+	st      state
+	fn      func(s *state) float32
+	gate    bool
+	retrigs uint64
+}
+
+func (r *cvProcessor) Process(b []float32) {
+	r.n++
+	evs, set := r.iface.block(&r.n, len(b))
+	if !r.init {
+		// Start from the interface state on the processing goroutine.
+		r.st.copyFrom(&r.iface.start)
+		r.retrigs, r.init = r.st.retrigs, true
+	}
+	r.st.configure(set)
+	for i := range b {
+		for len(evs) > 0 && evs[0].off <= i {
+			r.st.apply(evs[0].event)
+			evs = evs[1:]
+		}
+		v := r.fn(&r.st)
+		if r.gate && r.retrigs != r.st.retrigs {
+			r.retrigs = r.st.retrigs
+			v = 0
+		}
+		b[i] = v
+	}
+	// Events past the end of a shorter block.
+	for _, ev := range evs {
+		r.st.apply(ev.event)
+	}
+	r.retrigs = r.st.retrigs
+}
+
+func gateCV(s *state) float32           { return s.gate }
+func keyCV(s *state) float32            { return float32(s.key) / 12 }
+func velCV(s *state) float32            { return float32(s.vel) / 127 }
+func bendCV(s *state) float32           { return float32(s.bend) / 8192 }
+func pitchCV(s *state) float32          { return s.pitch() }
+func aftertouchCV(s *state) float32     { return float32(s.pressure) / 127 }
+func polyAftertouchCV(s *state) float32 { return float32(s.poly[s.key&0x7f]) / 127 }
+
+func keyAftertouchCV(key uint8) func(s *state) float32 {
+	return func(s *state) float32 { return float32(s.poly[key&0x7f]) / 127 }
+}
+
+func ccCV(n uint8) func(s *state) float32 {
+	return func(s *state) float32 { return float32(s.cc[n&0x7f]) / 127 }
+}
+
+// cv returns a processor for the value fn of the interface state.
+func (i *Interface) cv(fn func(s *state) float32) modular.Processor {
+	i.addProcessor()
+	return &cvProcessor{iface: i, fn: fn}
+}
+
+// SetBendRange sets the pitch bend range in semitones used by Pitch.
+//
+// The default is 2 semitones.
+func (i *Interface) SetBendRange(semitones float32) {
+	i.updateSettings(func(set *settings) { set.bendRange = semitones })
+}
+
+// Vel returns the velocity CV of the last note in the range 0 to 1.
+func (i *Interface) Vel() modular.Processor {
+	return i.cv(velCV)
+}
+
+// Bend returns the pitch bend CV in the range -1 to 1.
+func (i *Interface) Bend() modular.Processor {
+	return i.cv(bendCV)
+}
+
+// Pitch returns the pitch CV of the last note with pitch bend applied.
+//
+// Pitch uses the one-volt-per-octave standard compatible with osc.Osc.Voltage.
+func (i *Interface) Pitch() modular.Processor {
+	return i.cv(pitchCV)
+}
+
+// Aftertouch returns the channel pressure CV in the range 0 to 1.
+func (i *Interface) Aftertouch() modular.Processor {
+	return i.cv(aftertouchCV)
+}
+
+// PolyAftertouch returns the polyphonic pressure CV of the last note in the range 0 to 1.
+func (i *Interface) PolyAftertouch() modular.Processor {
+	return i.cv(polyAftertouchCV)
+}
+
+// KeyAftertouch returns the polyphonic pressure CV of key in the range 0 to 1.
+func (i *Interface) KeyAftertouch(key uint8) modular.Processor {
+	return i.cv(keyAftertouchCV(key))
+}
+
+// CC returns the CV of controller n in the range 0 to 1.
+func (i *Interface) CC(n uint8) modular.Processor {
+	return i.cv(ccCV(n))
+}
@@ -0,0 +1,282 @@
+package midi
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"gitlab.com/gomidi/midi"
+)
+
+// In returns the input port of drv at index i.
+func In(drv midi.Driver, i int) (midi.In, error) {
+	ins, err := drv.Ins()
+	if err != nil {
+		return nil, fmt.Errorf("midi.In: %v", err)
+	}
+	if i < 0 || i >= len(ins) {
+		return nil, fmt.Errorf("midi.In: port %d out of range (%s has %d inputs)", i, drv, len(ins))
+	}
+	return ins[i], nil
+}
+
+// InNamed returns the input port of drv with the given name.
+//
+// An exact match is preferred, otherwise the first port
+// containing name ignoring case is returned.
+func InNamed(drv midi.Driver, name string) (midi.In, error) {
+	ins, err := drv.Ins()
+	if err != nil {
+		return nil, fmt.Errorf("midi.InNamed: %v", err)
+	}
+	for _, in := range ins {
+		if in.String() == name {
+			return in, nil
+		}
+	}
+	for _, in := range ins {
+		if strings.Contains(strings.ToLower(in.String()), strings.ToLower(name)) {
+			return in, nil
+		}
+	}
+	return nil, fmt.Errorf("midi.InNamed: no input named %q on %s", name, drv)
+}
+
+// Out returns the output port of drv at index i.
+func Out(drv midi.Driver, i int) (midi.Out, error) {
+	outs, err := drv.Outs()
+	if err != nil {
+		return nil, fmt.Errorf("midi.Out: %v", err)
+	}
+	if i < 0 || i >= len(outs) {
+		return nil, fmt.Errorf("midi.Out: port %d out of range (%s has %d outputs)", i, drv, len(outs))
+	}
+	return outs[i], nil
+}
+
+// OutNamed returns the output port of drv with the given name.
+//
+// An exact match is preferred, otherwise the first port
+// containing name ignoring case is returned.
+func OutNamed(drv midi.Driver, name string) (midi.Out, error) {
+	outs, err := drv.Outs()
+	if err != nil {
+		return nil, fmt.Errorf("midi.OutNamed: %v", err)
+	}
+	for _, out := range outs {
+		if out.String() == name {
+			return out, nil
+		}
+	}
+	for _, out := range outs {
+		if strings.Contains(strings.ToLower(out.String()), strings.ToLower(name)) {
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("midi.OutNamed: no output named %q on %s", name, drv)
+}
+
+// MemDriver is an in-memory MIDI driver.
+//
+// MemDriver allows injecting and recording MIDI messages without
+// hardware such as in tests. Messages are delivered synchronously.
+type MemDriver struct {
+	mu   sync.Mutex
+	name string
+	ins  []*MemIn
+	outs []*MemOut
+}
+
+// NewMemDriver returns a new in-memory driver without ports.
+func NewMemDriver(name string) *MemDriver {
+	return &MemDriver{name: name}
+}
+
+// AddIn adds a new input port named name.
+func (d *MemDriver) AddIn(name string) *MemIn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	in := &MemIn{name: name, number: len(d.ins)}
+	d.ins = append(d.ins, in)
+	return in
+}
+
+func (d *MemDriver) Ins() ([]midi.In, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ins := make([]midi.In, len(d.ins))
+	for i, in := range d.ins {
+		ins[i] = in
+	}
+	return ins, nil
+}
+
+// AddOut adds a new output port named name.
+func (d *MemDriver) AddOut(name string) *MemOut {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := &MemOut{name: name, number: len(d.outs)}
+	d.outs = append(d.outs, out)
+	return out
+}
+
+func (d *MemDriver) Outs() ([]midi.Out, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	outs := make([]midi.Out, len(d.outs))
+	for i, out := range d.outs {
+		outs[i] = out
+	}
+	return outs, nil
+}
+
+func (d *MemDriver) String() string {
+	return d.name
+}
+
+// Close closes all ports.
+func (d *MemDriver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, in := range d.ins {
+		in.Close()
+	}
+	for _, out := range d.outs {
+		out.Close()
+	}
+	return nil
+}
+
+// MemIn is an in-memory MIDI input port.
+type MemIn struct {
+	mu       sync.Mutex
+	name     string
+	number   int
+	open     bool
+	listener func(data []byte, deltaMicroseconds int64)
+}
+
+// Send delivers the raw MIDI message data to the listener.
+//
+// delta is the time since the previous message in microseconds.
+// Interfaces timestamp the message delta after the previous message,
+// which makes message timing deterministic in tests.
+// Send returns midi.ErrPortClosed if the port is not open.
+func (in *MemIn) Send(data []byte, delta int64) error {
+	in.mu.Lock()
+	if !in.open {
+		in.mu.Unlock()
+		return midi.ErrPortClosed
+	}
+	l := in.listener
+	in.mu.Unlock()
+	if l != nil {
+		l(data, delta)
+	}
+	return nil
+}
+
+func (in *MemIn) Open() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.open = true
+	return nil
+}
+
+func (in *MemIn) Close() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.open, in.listener = false, nil
+	return nil
+}
+
+func (in *MemIn) IsOpen() bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.open
+}
+
+func (in *MemIn) Number() int             { return in.number }
+func (in *MemIn) String() string          { return in.name }
+func (in *MemIn) Underlying() interface{} { return nil }
+
+func (in *MemIn) SetListener(l func(data []byte, deltaMicroseconds int64)) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if !in.open {
+		return midi.ErrPortClosed
+	}
+	in.listener = l
+	return nil
+}
+
+func (in *MemIn) StopListening() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.listener = nil
+	return nil
+}
+
+// MemOut is an in-memory MIDI output port recording written messages.
+type MemOut struct {
+	mu     sync.Mutex
+	name   string
+	number int
+	open   bool
+	msgs   [][]byte
+}
+
+// Messages returns a copy of the messages written since the last Reset.
+func (out *MemOut) Messages() [][]byte {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	msgs := make([][]byte, len(out.msgs))
+	for i, m := range out.msgs {
+		msgs[i] = append([]byte(nil), m...)
+	}
+	return msgs
+}
+
+// Reset clears the recorded messages.
+func (out *MemOut) Reset() {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.msgs = out.msgs[:0]
+}
+
+// Write records the message b.
+//
+// Write returns midi.ErrPortClosed if the port is not open.
+func (out *MemOut) Write(b []byte) (int, error) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if !out.open {
+		return 0, midi.ErrPortClosed
+	}
+	out.msgs = append(out.msgs, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (out *MemOut) Open() error {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.open = true
+	return nil
+}
+
+func (out *MemOut) Close() error {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.open = false
+	return nil
+}
+
+func (out *MemOut) IsOpen() bool {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	return out.open
+}
+
+func (out *MemOut) Number() int             { return out.number }
+func (out *MemOut) String() string          { return out.name }
+func (out *MemOut) Underlying() interface{} { return nil }
@@ -0,0 +1,442 @@
+package midi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// Param is a module parameter controlled by MIDI.
+//
+// Param.Value can be passed as a parameter closure,
+// e.g. f.SetCutoff(p.Value). Param is safe for concurrent use.
+type Param struct {
+	name string
+	v    uint32 // float32 bits
+}
+
+// Name returns the name of the parameter.
+func (p *Param) Name() string {
+	return p.name
+}
+
+// Value returns the current value of the parameter.
+func (p *Param) Value() float32 {
+	return math.Float32frombits(atomic.LoadUint32(&p.v))
+}
+
+// Set sets the value of the parameter.
+func (p *Param) Set(v float32) {
+	atomic.StoreUint32(&p.v, math.Float32bits(v))
+}
+
+// ControlKind is the kind of controller of a binding.
+type ControlKind int
+
+const (
+	CC     ControlKind = iota // 7-bit control change
+	CC14                      // 14-bit control change using controllers n and n+32
+	NRPN                      // 7-bit non-registered parameter number
+	NRPN14                    // 14-bit non-registered parameter number
+)
+
+var controlKinds = []string{"cc", "cc14", "nrpn", "nrpn14"}
+
+func (k ControlKind) String() string {
+	if k < 0 || int(k) >= len(controlKinds) {
+		return fmt.Sprintf("ControlKind(%d)", int(k))
+	}
+	return controlKinds[k]
+}
+
+func (k ControlKind) MarshalText() ([]byte, error) {
+	if k < 0 || int(k) >= len(controlKinds) {
+		return nil, fmt.Errorf("midi.ControlKind.MarshalText: invalid kind %d", int(k))
+	}
+	return []byte(k.String()), nil
+}
+
+func (k *ControlKind) UnmarshalText(text []byte) error {
+	for i, s := range controlKinds {
+		if s == string(text) {
+			*k = ControlKind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("midi.ControlKind.UnmarshalText: unknown kind %q", text)
+}
+
+// Curve shapes controller values.
+type Curve int
+
+const (
+	Linear Curve = iota
+	Exponential
+	Logarithmic
+)
+
+var curves = []string{"linear", "exp", "log"}
+
+func (c Curve) String() string {
+	if c < 0 || int(c) >= len(curves) {
+		return fmt.Sprintf("Curve(%d)", int(c))
+	}
+	return curves[c]
+}
+
+func (c Curve) MarshalText() ([]byte, error) {
+	if c < 0 || int(c) >= len(curves) {
+		return nil, fmt.Errorf("midi.Curve.MarshalText: invalid curve %d", int(c))
+	}
+	return []byte(c.String()), nil
+}
+
+func (c *Curve) UnmarshalText(text []byte) error {
+	for i, s := range curves {
+		if s == string(text) {
+			*c = Curve(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("midi.Curve.UnmarshalText: unknown curve %q", text)
+}
+
+// shape maps x in the range 0 to 1 along the curve.
+func (c Curve) shape(x float64) float64 {
+	switch c {
+	case Exponential:
+		return (math.Exp2(4*x) - 1) / 15
+	case Logarithmic:
+		return math.Log2(1+15*x) / 4
+	default:
+		return x
+	}
+}
+
+// Binding binds a MIDI controller to a parameter.
+type Binding struct {
+	Param   string      `json:"param"`
+	Kind    ControlKind `json:"kind"`
+	Channel uint8       `json:"channel"`
+	// Controller is the CC number or the NRPN parameter number.
+	Controller uint16  `json:"controller"`
+	Min        float32 `json:"min"`
+	Max        float32 `json:"max"`
+	Curve      Curve   `json:"curve"`
+}
+
+// value maps the normalized controller value x to the parameter range.
+func (b *Binding) value(x float64) float32 {
+	return b.Min + (b.Max-b.Min)*float32(b.Curve.shape(x))
+}
+
+// Controller numbers used for NRPN and 14-bit controllers.
+const (
+	dataEntryMSB = 6
+	dataEntryLSB = 38
+	nrpnLSB      = 98
+	nrpnMSB      = 99
+	rpnLSB       = 100
+	rpnMSB       = 101
+)
+
+// channelControls is the controller state of a MIDI channel.
+type channelControls struct {
+	cc        [128]uint8
+	param     uint16 // selected NRPN parameter
+	nrpn      bool   // whether an NRPN is selected
+	data, lsb uint8  // NRPN data entry
+}
+
+// Mapper maps MIDI controllers to parameters.
+//
+// Mapper implements ControlHandler. Arm a parameter with Learn and
+// move a controller to bind it. Bindings can be saved and loaded
+// alongside a patch.
+type Mapper struct {
+	mu       sync.Mutex
+	params   map[string]*Param
+	bindings []Binding
+	chans    [16]channelControls
+
+	armed   string
+	learned int // index of the last learned binding or -1
+}
+
+// NewMapper returns a new mapper without parameters.
+func NewMapper() *Mapper {
+	return &Mapper{params: make(map[string]*Param), learned: -1}
+}
+
+// Param returns the parameter name creating it with value v if needed.
+func (m *Mapper) Param(name string, v float32) *Param {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.params[name]; ok {
+		return p
+	}
+	p := &Param{name: name}
+	p.Set(v)
+	m.params[name] = p
+	return p
+}
+
+// Learn arms the parameter name with the range min to max and curve c.
+//
+// The next controller moved is bound to the parameter replacing
+// existing bindings of the parameter.
+func (m *Mapper) Learn(name string, min, max float32, c Curve) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.params[name]; !ok {
+		return fmt.Errorf("midi.Mapper.Learn: unknown parameter %q", name)
+	}
+	m.cancel()
+	m.unbind(name)
+	m.armed = name
+	m.bindings = append(m.bindings, Binding{Param: name, Min: min, Max: max, Curve: c})
+	m.learned = -1
+	return nil
+}
+
+// Learning returns the armed parameter or the empty string.
+func (m *Mapper) Learning() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.armed
+}
+
+// CancelLearn disarms the armed parameter.
+func (m *Mapper) CancelLearn() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancel()
+}
+
+func (m *Mapper) cancel() {
+	if m.armed == "" {
+		return
+	}
+	m.bindings = m.bindings[:len(m.bindings)-1]
+	m.armed = ""
+}
+
+// Bind adds the binding b.
+func (m *Mapper) Bind(b Binding) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.params[b.Param]; !ok {
+		return fmt.Errorf("midi.Mapper.Bind: unknown parameter %q", b.Param)
+	}
+	if err := b.validate(); err != nil {
+		return fmt.Errorf("midi.Mapper.Bind: %v", err)
+	}
+	m.insert(b)
+	return nil
+}
+
+// insert adds b before the armed binding.
+func (m *Mapper) insert(b Binding) {
+	if m.armed == "" {
+		m.bindings = append(m.bindings, b)
+		return
+	}
+	n := len(m.bindings)
+	m.bindings = append(m.bindings[:n-1], b, m.bindings[n-1])
+}
+
+func (b *Binding) validate() error {
+	switch {
+	case b.Kind < CC || b.Kind > NRPN14:
+		return fmt.Errorf("invalid kind %d", int(b.Kind))
+	case b.Channel > 15:
+		return fmt.Errorf("channel %d out of range", b.Channel)
+	case b.Kind == CC && b.Controller > 127,
+		b.Kind == CC14 && b.Controller > 31,
+		b.Controller > 16383:
+		return fmt.Errorf("%v controller %d out of range", b.Kind, b.Controller)
+	}
+	return nil
+}
+
+// Unbind removes all bindings of the parameter name.
+func (m *Mapper) Unbind(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.armed == name {
+		m.armed = ""
+	}
+	m.unbind(name)
+	m.learned = -1
+}
+
+func (m *Mapper) unbind(name string) {
+	bs := m.bindings[:0]
+	for _, b := range m.bindings {
+		if b.Param != name {
+			bs = append(bs, b)
+		}
+	}
+	m.bindings = bs
+}
+
+// Bindings returns the bindings excluding an armed parameter.
+func (m *Mapper) Bindings() []Binding {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bs := m.bindings
+	if m.armed != "" {
+		bs = bs[:len(bs)-1]
+	}
+	return append([]Binding(nil), bs...)
+}
+
+// learn binds the armed parameter to the controller or upgrades
+// the last learned binding to 14 bits.
+func (m *Mapper) learn(kind ControlKind, ch uint8, n uint16) {
+	if m.learned >= 0 {
+		b := &m.bindings[m.learned]
+		if b.Channel == ch && (b.Kind == CC && kind == CC && n == b.Controller+32 ||
+			b.Kind == NRPN && kind == NRPN14 && n == b.Controller) {
+			b.Kind++
+			m.learned = -1
+			return
+		}
+		m.learned = -1
+	}
+	if m.armed == "" || kind == CC14 || kind == NRPN14 {
+		return
+	}
+	b := &m.bindings[len(m.bindings)-1]
+	b.Kind, b.Channel, b.Controller = kind, ch, n
+	m.armed = ""
+	if kind == NRPN || n < 32 {
+		// Wait for a LSB to follow.
+		m.learned = len(m.bindings) - 1
+	}
+}
+
+// ControlChange updates the parameters bound to the controller n.
+func (m *Mapper) ControlChange(ch, n, value uint8) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch &= 0xf
+	n &= 0x7f
+	value &= 0x7f
+	c := &m.chans[ch]
+	c.cc[n] = value
+	if n < 32 {
+		// A new MSB resets the LSB of 14-bit controllers.
+		c.cc[n+32] = 0
+	}
+	switch n {
+	case nrpnMSB:
+		c.param = uint16(value)<<7 | c.param&0x7f
+		c.nrpn = true
+		return
+	case nrpnLSB:
+		c.param = c.param&^0x7f | uint16(value)
+		c.nrpn = true
+		return
+	case rpnMSB, rpnLSB:
+		c.nrpn = false
+		return
+	case dataEntryMSB, dataEntryLSB:
+		if !c.nrpn {
+			break
+		}
+		kind := NRPN
+		if n == dataEntryMSB {
+			c.data, c.lsb = value, 0
+		} else {
+			c.lsb = value
+			kind = NRPN14
+		}
+		m.learn(kind, ch, c.param)
+		m.update(ch, kind, c.param)
+		return
+	}
+	m.learn(CC, ch, uint16(n))
+	m.update(ch, CC, uint16(n))
+	switch {
+	case n < 32:
+		m.update(ch, CC14, uint16(n))
+	case n < 64:
+		m.update(ch, CC14, uint16(n-32))
+	}
+}
+
+// update sets the parameters bound to the controller.
+//
+// NRPN and NRPN14 updates also update bindings of the other kind.
+func (m *Mapper) update(ch uint8, kind ControlKind, n uint16) {
+	c := &m.chans[ch]
+	for i := range m.bindings {
+		b := &m.bindings[i]
+		if b.Channel != ch || b.Controller != n || m.armed != "" && i == len(m.bindings)-1 {
+			continue
+		}
+		var x float64
+		switch {
+		case b.Kind == CC && kind == CC:
+			x = float64(c.cc[n]) / 127
+		case b.Kind == CC14 && kind == CC14:
+			x = float64(uint16(c.cc[n])<<7|uint16(c.cc[n+32])) / 16383
+		case b.Kind == NRPN && (kind == NRPN || kind == NRPN14):
+			x = float64(c.data) / 127
+		case b.Kind == NRPN14 && (kind == NRPN || kind == NRPN14):
+			x = float64(uint16(c.data)<<7|uint16(c.lsb)) / 16383
+		default:
+			continue
+		}
+		m.params[b.Param].Set(b.value(x))
+	}
+}
+
+type mapping struct {
+	Bindings []Binding `json:"bindings"`
+}
+
+// MarshalJSON encodes the bindings of the mapper.
+func (m *Mapper) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mapping{Bindings: m.Bindings()})
+}
+
+// UnmarshalJSON decodes bindings into the mapper replacing existing bindings.
+//
+// Parameters of the bindings should be created before.
+func (m *Mapper) UnmarshalJSON(data []byte) error {
+	var def mapping
+	if err := json.Unmarshal(data, &def); err != nil {
+		return fmt.Errorf("midi.Mapper.UnmarshalJSON: %v", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range def.Bindings {
+		if _, ok := m.params[b.Param]; !ok {
+			return fmt.Errorf("midi.Mapper.UnmarshalJSON: unknown parameter %q", b.Param)
+		}
+		if err := b.validate(); err != nil {
+			return fmt.Errorf("midi.Mapper.UnmarshalJSON: %v", err)
+		}
+	}
+	m.bindings = def.Bindings
+	m.armed, m.learned = "", -1
+	return nil
+}
+
+// Save writes the bindings to w as JSON.
+func (m *Mapper) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(m)
+}
+
+// Load reads bindings from r as written by Save.
+func (m *Mapper) Load(r io.Reader) error {
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return fmt.Errorf("midi.Mapper.Load: %v", err)
+	}
+	return nil
+}
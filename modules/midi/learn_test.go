@@ -0,0 +1,26 @@
+package midi
+
+import "testing"
+
+func TestMapperCC14(t *testing.T) {
+	m := NewMapper()
+	p := m.Param("cutoff", 0)
+	if err := m.Bind(Binding{Param: "cutoff", Kind: CC14, Controller: 1, Max: 16383}); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	for _, tc := range []struct {
+		n, value uint8
+		want     float32
+	}{
+		{1, 64, 64 << 7},
+		{33, 127, 64<<7 | 127},
+		// The stale LSB is not combined with a new MSB.
+		{1, 65, 65 << 7},
+		{33, 1, 65<<7 | 1},
+	} {
+		m.ControlChange(0, tc.n, tc.value)
+		if got := p.Value(); got != tc.want {
+			t.Errorf("after CC %d = %d: got %v, want %v", tc.n, tc.value, got, tc.want)
+		}
+	}
+}
@@ -2,6 +2,10 @@ package midi
 
 import (
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ajzaff/go-modular"
 	"gitlab.com/gomidi/midi"
@@ -12,104 +16,402 @@ import (
 // Interface returns midi CVs for the stream of midi messages
 // on the single midi input channel (i, ch).
 //
-// Interface is unbuffered to minimize trigger latency.
+// Incoming messages are timestamped and queued to the audio goroutine
+// which applies them at their sample offsets within the next block.
+// Timestamps follow the message deltas reported by the input port,
+// starting from the interface clock at the first message.
+// This adds one block of latency but keeps the timing between messages.
+// Processors of an interface must be processed from the same goroutine,
+// which never blocks on the MIDI reader.
+//
+// The interface owns its input port and should be closed when done.
 type Interface struct {
-	gate float32
-	in   midi.In
-	ch   uint8
-	drv  *rtmididrv.Driver
+	in  midi.In
+	ch  uint8
+	drv midi.Driver
+
+	queue   chan timedEvent
+	procs   int32  // number of processors, events are queued when positive
+	dropped uint64 // events dropped on a full queue
+	restamp int32  // set when the clock changes
+
+	mu     sync.Mutex // guards closed and updates of hs and set
+	closed bool
+	hs     atomic.Value // *handlers
+	set    atomic.Value // settings
+	now    atomic.Value // func() time.Duration
+
+	// Owned by the MIDI reader goroutine.
+	stamp   time.Duration // time of the current message
+	stamped bool
+
+	// Owned by the processing goroutine and
+	// updated by the first processor of each block.
+	blockN  int64
+	last    time.Duration
+	later   []timedEvent // events after the end of the block
+	pending []timedEvent
+	cur     settings
+	start   state // state at the start of the block
+	st      state // state at the end of the block
 }
 
-// New creates a new midi interface on input i MIDI channel ch.
-func New(i, ch uint8) (iface *Interface, err error) {
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("midi.New: %v", err)
-		}
-	}()
+// queueSize is the number of events buffered between blocks.
+//
+// Events are dropped when the queue is full.
+const queueSize = 1024
+
+// maxLag is the lag behind the interface clock after which
+// message timestamps are restarted from the clock.
+const maxLag = 50 * time.Millisecond
+
+// timedEvent is an event with its arrival time and block offset.
+type timedEvent struct {
+	event
+	t   time.Duration
+	off int
+}
 
+// NoteHandler handles note events on the interface channel.
+//
+// Handlers are called from the MIDI reader goroutine.
+type NoteHandler interface {
+	NoteOn(key, vel uint8)
+	NoteOff(key uint8)
+}
+
+// ControlHandler handles control change events.
+//
+// Handlers are called from the MIDI reader goroutine.
+type ControlHandler interface {
+	ControlChange(ch, n, value uint8)
+}
+
+// New creates a new midi interface on input i MIDI channel ch
+// using the default rtmidi driver.
+func New(i, ch uint8) (*Interface, error) {
 	drv, err := rtmididrv.New()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("midi.New: %v", err)
+	}
+	in, err := In(drv, int(i))
+	if err != nil {
+		drv.Close()
+		return nil, fmt.Errorf("midi.New: %v", err)
 	}
+	iface, err := NewIn(in, ch)
+	if err != nil {
+		drv.Close()
+		return nil, fmt.Errorf("midi.New: %v", err)
+	}
+	iface.drv = drv
+	return iface, nil
+}
 
-	ins, err := drv.Ins()
-	if len(ins) <= int(i) {
-		return nil, err
+// NewIn creates a new midi interface on the input in MIDI channel ch.
+//
+// The input is opened if needed and closed by Close. See In and
+// InNamed to look up ports of a driver.
+func NewIn(in midi.In, ch uint8) (*Interface, error) {
+	if !in.IsOpen() {
+		if err := in.Open(); err != nil {
+			return nil, fmt.Errorf("midi.NewIn: %v", err)
+		}
 	}
+	start := time.Now()
+	i := &Interface{
+		ch:    ch,
+		in:    in,
+		queue: make(chan timedEvent, queueSize),
+		st:    newState(),
+	}
+	i.hs.Store(&handlers{})
+	i.set.Store(newSettings())
+	i.now.Store(func() time.Duration { return time.Since(start) })
+	if err := i.listen(); err != nil {
+		in.Close()
+		return nil, fmt.Errorf("midi.NewIn: %v", err)
+	}
+	return i, nil
+}
 
-	in := ins[i]
-	if err := in.Open(); err != nil {
-		return nil, err
+// Close stops listening and closes the input port and the driver
+// if it was opened by New.
+//
+// Processors keep returning the last CVs after Close.
+// Calling Close more than once has no effect.
+func (i *Interface) Close() error {
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		return nil
 	}
+	i.closed = true
+	i.mu.Unlock()
 
-	iface = &Interface{ch: ch, in: in}
-	return iface, nil
+	// Close outside the lock since the reader may be blocked in handle.
+	var errs []string
+	if err := i.in.StopListening(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := i.in.Close(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if i.drv != nil {
+		if err := i.drv.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("midi.Interface.Close: %s", strings.Join(errs, "; "))
+	}
+	return nil
 }
 
 func (i *Interface) SetConfig(cfg *modular.Config) error {
 	return nil
 }
 
-func (i *Interface) GateKey() (gate, key modular.Processor) {
-	ch := i.ch
-	g, k := &midiGateProcessor{}, &midiKeyProcessor{}
-	rd := reader.New(reader.NoLogger())
-	rd.Channel.NoteOn = func(p *reader.Position, channel uint8, key uint8, velocity uint8) {
-		if channel != ch {
-			return
-		}
-		k.key = float32(key)
-		g.gate = 1
+// handlers returns the current handlers.
+func (i *Interface) handlers() *handlers {
+	return i.hs.Load().(*handlers)
+}
+
+// updateHandlers replaces the handlers with a copy updated by fn.
+//
+// Readers keep using the previous handlers without locking.
+func (i *Interface) updateHandlers(fn func(hs *handlers)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	hs := i.handlers().clone()
+	fn(hs)
+	i.hs.Store(hs)
+}
+
+// updateSettings replaces the settings with a copy updated by fn.
+func (i *Interface) updateSettings(fn func(set *settings)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	set := i.set.Load().(settings)
+	fn(&set)
+	i.set.Store(set)
+}
+
+// clock returns the time of the interface clock.
+func (i *Interface) clock() time.Duration {
+	return i.now.Load().(func() time.Duration)()
+}
+
+// handle queues the event ev on the interface channel
+// and forwards note and control events to the handlers.
+// MPE decoders receive events on all channels.
+//
+// Events are only queued while the interface has processors.
+func (i *Interface) handle(ev event) {
+	hs := i.handlers()
+	for _, m := range hs.mpe {
+		m.handle(ev)
 	}
-	rd.Channel.NoteOff = func(p *reader.Position, channel uint8, key uint8, velocity uint8) {
-		if channel != ch {
-			return
-		}
-		g.gate = 0
+	if !ev.system() && ev.ch != i.ch {
+		return
 	}
-	if err := rd.ListenTo(i.in); err != nil {
-		panic(fmt.Errorf("midi.Interface.Key: %v", err))
+	if atomic.LoadInt32(&i.procs) > 0 {
+		select {
+		case i.queue <- timedEvent{event: ev, t: i.stamp}:
+		default:
+			atomic.AddUint64(&i.dropped, 1)
+		}
 	}
-	return g, k
+	ev.dispatch(hs)
 }
 
-type midiKeyProcessor struct {
-	in  midi.In
-	key float32
+// handleSysEx forwards the sysex message data to the tunings.
+func (i *Interface) handleSysEx(data []byte) {
+	for _, t := range i.handlers().tunings {
+		t.handleSysEx(data)
+	}
 }
 
-func (r *midiKeyProcessor) Process(b []float32) {
-	for i := range b {
-		b[i] = r.key
+// timestamp sets the time of the next message from its delta
+// since the previous message.
+//
+// The first message and messages lagging the clock are
+// timestamped with the clock.
+func (i *Interface) timestamp(delta time.Duration) {
+	now := i.clock()
+	t := i.stamp + delta
+	if atomic.CompareAndSwapInt32(&i.restamp, 1, 0) || !i.stamped || now-t > maxLag {
+		t = now
 	}
+	i.stamp, i.stamped = t, true
 }
 
-func (r *midiKeyProcessor) Close() error {
-	if err := r.in.StopListening(); err != nil {
-		return err
-	}
-	return r.in.Close()
+// stampedIn timestamps messages before they are handled by the reader.
+type stampedIn struct {
+	midi.In
+	i *Interface
+}
+
+func (in stampedIn) SetListener(l func(data []byte, deltaMicroseconds int64)) error {
+	return in.In.SetListener(func(data []byte, deltaMicroseconds int64) {
+		in.i.timestamp(time.Duration(deltaMicroseconds) * time.Microsecond)
+		l(data, deltaMicroseconds)
+	})
 }
 
-type midiGateProcessor struct {
-	in   midi.In
-	gate float32
+// Dropped returns the number of events dropped because
+// the processors fell behind and the queue was full.
+func (i *Interface) Dropped() uint64 {
+	return atomic.LoadUint64(&i.dropped)
 }
 
-func (r *midiGateProcessor) Process(b []float32) {
-	for i := range b {
-		b[i] = r.gate
+// SetClock sets the clock used to timestamp messages and blocks.
+//
+// The default is the time since the interface was created.
+// A custom clock is useful for tests and offline rendering.
+func (i *Interface) SetClock(now func() time.Duration) {
+	i.now.Store(now)
+	atomic.StoreInt32(&i.restamp, 1)
+}
+
+// addProcessor registers a processor so events are queued.
+func (i *Interface) addProcessor() {
+	atomic.AddInt32(&i.procs, 1)
+}
+
+// block returns the events for the block n of size samples.
+//
+// The first processor to reach a new block drains the queue and maps
+// the events timestamped since the previous block to offsets in the block.
+// Events timestamped after the block are kept for later blocks.
+// Processors behind the last block catch up to it.
+func (i *Interface) block(n *int64, size int) ([]timedEvent, settings) {
+	if *n <= i.blockN {
+		*n = i.blockN
+		return i.pending, i.cur
+	}
+	first := i.blockN == 0
+	i.blockN = *n
+	i.pending = i.pending[:0]
+	i.cur = i.set.Load().(settings)
+	t := i.clock()
+	if first {
+		i.last = t
+	}
+	window := t - i.last
+	for done := false; !done; {
+		select {
+		case ev := <-i.queue:
+			i.later = append(i.later, ev)
+		default:
+			done = true
+		}
+	}
+	// Timestamps are in increasing order.
+	k := 0
+	for _, ev := range i.later {
+		if ev.t > t {
+			break
+		}
+		if window > 0 && ev.t > i.last {
+			ev.off = int(int64(size) * int64(ev.t-i.last) / int64(window))
+		}
+		if ev.off >= size {
+			ev.off = size - 1
+		}
+		i.pending = append(i.pending, ev)
+		k++
+	}
+	i.later = append(i.later[:0], i.later[k:]...)
+	i.last = t
+	i.st.configure(i.cur)
+	i.start.copyFrom(&i.st)
+	for _, ev := range i.pending {
+		i.st.apply(ev.event)
 	}
+	return i.pending, i.cur
 }
 
-func (r *midiGateProcessor) Close() error {
-	if err := r.in.StopListening(); err != nil {
-		return err
+// listen starts listening to the input.
+func (i *Interface) listen() error {
+	rd := reader.New(reader.NoLogger())
+	rd.Channel.NoteOn = func(p *reader.Position, channel uint8, key uint8, velocity uint8) {
+		i.handle(event{kind: noteOnEvent, ch: channel, a: key, b: velocity})
+	}
+	rd.Channel.NoteOff = func(p *reader.Position, channel uint8, key uint8, velocity uint8) {
+		i.handle(event{kind: noteOffEvent, ch: channel, a: key, b: velocity})
+	}
+	rd.Channel.Pitchbend = func(p *reader.Position, channel uint8, value int16) {
+		i.handle(event{kind: pitchBendEvent, ch: channel, bend: value})
+	}
+	rd.Channel.Aftertouch = func(p *reader.Position, channel uint8, pressure uint8) {
+		i.handle(event{kind: aftertouchEvent, ch: channel, a: pressure})
+	}
+	rd.Channel.PolyAftertouch = func(p *reader.Position, channel uint8, key uint8, pressure uint8) {
+		i.handle(event{kind: polyAftertouchEvent, ch: channel, a: key, b: pressure})
 	}
-	return r.in.Close()
+	rd.Channel.ControlChange.Each = func(p *reader.Position, channel uint8, controller uint8, value uint8) {
+		i.handle(event{kind: controlChangeEvent, ch: channel, a: controller, b: value})
+	}
+	rd.Realtime.Clock = func() { i.handle(event{kind: clockEvent}) }
+	rd.Realtime.Start = func() { i.handle(event{kind: startEvent}) }
+	rd.Realtime.Stop = func() { i.handle(event{kind: stopEvent}) }
+	rd.Realtime.Continue = func() { i.handle(event{kind: continueEvent}) }
+	rd.SysCommon.SPP = func(pos uint16) { i.handle(event{kind: songPositionEvent, spp: swap7(pos)}) }
+	rd.SysEx.Complete = func(p *reader.Position, data []byte) { i.handleSysEx(data) }
+	return rd.ListenTo(stampedIn{In: i.in, i: i})
+}
+
+// Notes forwards note events on the interface channel to h.
+func (i *Interface) Notes(h NoteHandler) error {
+	var err error
+	i.updateHandlers(func(hs *handlers) {
+		if i.closed {
+			err = fmt.Errorf("midi.Interface.Notes: interface is closed")
+			return
+		}
+		hs.notes = append(hs.notes, h)
+	})
+	return err
 }
 
-func (i *Interface) Vel() modular.Processor {
-	panic("midi.Interface.Vel: not implemented")
+// Controls forwards control change events on the interface channel to h.
+func (i *Interface) Controls(h ControlHandler) error {
+	var err error
+	i.updateHandlers(func(hs *handlers) {
+		if i.closed {
+			err = fmt.Errorf("midi.Interface.Controls: interface is closed")
+			return
+		}
+		hs.controls = append(hs.controls, h)
+	})
+	return err
+}
+
+// SetPriority sets the note priority among held notes.
+//
+// The default is Last.
+func (i *Interface) SetPriority(p Priority) {
+	i.updateSettings(func(set *settings) { set.priority = p })
+}
+
+// SetLegato enables or disables legato mode.
+//
+// In legato mode the gate stays open when the playing note changes.
+// Otherwise the gate closes for one sample to retrigger envelopes.
+func (i *Interface) SetLegato(legato bool) {
+	i.updateSettings(func(set *settings) { set.legato = legato })
+}
+
+// GateKey returns processors for the gate and key of the playing note.
+//
+// The key CV is in volts at one volt per octave like Pitch, without
+// pitch bend. The gate stays open while any note is held and the key
+// returns to the previous held note when the playing note is released.
+//
+// GateKey may be called more than once to feed several patches.
+func (i *Interface) GateKey() (gate, key modular.Processor) {
+	g := i.cv(gateCV).(*cvProcessor)
+	g.gate = true
+	return g, i.cv(keyCV)
 }
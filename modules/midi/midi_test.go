@@ -0,0 +1,279 @@
+package midi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ajzaff/go-modular"
+	"gitlab.com/gomidi/midi"
+)
+
+// blockSize and blockTime make one sample per millisecond.
+const (
+	blockSize = 100
+	blockTime = 100 * time.Millisecond
+)
+
+// testRig drives an interface on an in-memory input with a fake clock.
+type testRig struct {
+	t     *testing.T
+	in    *MemIn
+	iface *Interface
+	now   time.Duration
+}
+
+func newTestRig(t *testing.T, ch uint8) *testRig {
+	t.Helper()
+	drv := NewMemDriver("test")
+	in := drv.AddIn("in")
+	iface, err := NewIn(in, ch)
+	if err != nil {
+		t.Fatalf("NewIn: %v", err)
+	}
+	r := &testRig{t: t, in: in, iface: iface}
+	iface.SetClock(func() time.Duration { return r.now })
+	t.Cleanup(func() { iface.Close() })
+	return r
+}
+
+// send sends msg at delta after the previous message.
+func (r *testRig) send(delta time.Duration, msg ...byte) {
+	r.t.Helper()
+	if err := r.in.Send(msg, delta.Microseconds()); err != nil {
+		r.t.Fatalf("Send: %v", err)
+	}
+}
+
+// process advances the clock by one block and processes ps in order.
+func (r *testRig) process(ps ...modular.Processor) [][]float32 {
+	r.now += blockTime
+	var res [][]float32
+	for _, p := range ps {
+		b := make([]float32, blockSize)
+		p.Process(b)
+		res = append(res, b)
+	}
+	return res
+}
+
+func TestGateKey(t *testing.T) {
+	r := newTestRig(t, 0)
+	gate, key := r.iface.GateKey()
+	r.process(gate, key)
+
+	r.send(0, 0x90, 60, 100)
+	r.send(0, 0x91, 72, 100) // other channel
+	r.send(10*time.Millisecond, 0x90, 64, 100)
+	r.send(30*time.Millisecond, 0x80, 64, 0)
+	r.send(20*time.Millisecond, 0x80, 60, 0)
+	bs := r.process(gate, key)
+	g, k := bs[0], bs[1]
+
+	for _, tc := range []struct {
+		i          int
+		gate, keyV float32
+	}{
+		{0, 1, 60. / 12},
+		{9, 1, 60. / 12},
+		{10, 0, 64. / 12}, // retrigger
+		{11, 1, 64. / 12},
+		{39, 1, 64. / 12},
+		{40, 0, 60. / 12}, // back to the held note
+		{41, 1, 60. / 12},
+		{59, 1, 60. / 12},
+		{60, 0, 60. / 12},
+		{99, 0, 60. / 12},
+	} {
+		if g[tc.i] != tc.gate || k[tc.i] != tc.keyV {
+			t.Errorf("sample %d: got gate %v key %v, want %v %v", tc.i, g[tc.i], k[tc.i], tc.gate, tc.keyV)
+		}
+	}
+}
+
+func TestDeltaTimestamps(t *testing.T) {
+	r := newTestRig(t, 0)
+	gate, _ := r.iface.GateKey()
+	r.process(gate)
+
+	// Messages are sent at once but timestamped by their deltas
+	// across blocks.
+	r.send(0, 0x90, 60, 100)
+	r.send(150*time.Millisecond, 0x80, 60, 0)
+	g := r.process(gate)[0]
+	if g[0] != 1 || g[99] != 1 {
+		t.Errorf("first block: got gate %v %v, want 1 1", g[0], g[99])
+	}
+	g = r.process(gate)[0]
+	if g[49] != 1 || g[50] != 0 {
+		t.Errorf("second block: got gate %v %v, want 1 0", g[49], g[50])
+	}
+}
+
+func TestPriority(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		p    Priority
+		want float32
+	}{
+		{"Last", Last, 62},
+		{"Lowest", Lowest, 60},
+		{"Highest", Highest, 64},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestRig(t, 0)
+			r.iface.SetPriority(tc.p)
+			_, key := r.iface.GateKey()
+			r.process(key)
+			r.send(0, 0x90, 60, 100)
+			r.send(0, 0x90, 64, 100)
+			r.send(0, 0x90, 62, 100)
+			k := r.process(key)[0]
+			if got := k[blockSize-1] * 12; got != tc.want {
+				t.Errorf("got key %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLegato(t *testing.T) {
+	for _, tc := range []struct {
+		legato bool
+		want   float32
+	}{
+		{false, 0},
+		{true, 1},
+	} {
+		r := newTestRig(t, 0)
+		r.iface.SetLegato(tc.legato)
+		gate, _ := r.iface.GateKey()
+		r.process(gate)
+		r.send(0, 0x90, 60, 100)
+		r.send(20*time.Millisecond, 0x90, 62, 100)
+		g := r.process(gate)[0]
+		if g[20] != tc.want || g[21] != 1 {
+			t.Errorf("legato %v: got gate %v %v at the note change, want %v 1", tc.legato, g[20], g[21], tc.want)
+		}
+	}
+}
+
+func TestDropped(t *testing.T) {
+	r := newTestRig(t, 0)
+	// Without processors nothing is queued.
+	for i := 0; i < queueSize+10; i++ {
+		r.send(0, 0x90, 60, 100)
+	}
+	if n := r.iface.Dropped(); n != 0 {
+		t.Errorf("got %d dropped events without processors, want 0", n)
+	}
+	gate, _ := r.iface.GateKey()
+	for i := 0; i < queueSize+10; i++ {
+		r.send(0, 0x90, 60, 100)
+	}
+	if n := r.iface.Dropped(); n != 10 {
+		t.Errorf("got %d dropped events, want 10", n)
+	}
+	r.process(gate)
+}
+
+func TestClose(t *testing.T) {
+	r := newTestRig(t, 0)
+	gate, _ := r.iface.GateKey()
+	r.process(gate)
+	r.send(0, 0x90, 60, 100)
+	r.process(gate)
+
+	if err := r.iface.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := r.iface.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if err := r.in.Send([]byte{0x80, 60, 0}, 0); err != midi.ErrPortClosed {
+		t.Errorf("Send after Close: got %v, want %v", err, midi.ErrPortClosed)
+	}
+	if err := r.iface.Notes(nopNotes{}); err == nil {
+		t.Errorf("Notes after Close: got nil error")
+	}
+	if g := r.process(gate)[0]; g[0] != 1 {
+		t.Errorf("got gate %v after Close, want the last gate 1", g[0])
+	}
+}
+
+type nopNotes struct{}
+
+func (nopNotes) NoteOn(key, vel uint8) {}
+func (nopNotes) NoteOff(key uint8)     {}
+
+type mpeNote struct {
+	ch, key uint8
+	on      bool
+	bend    float32
+}
+
+type mpeRecorder struct {
+	notes []*mpeNote
+}
+
+func (h *mpeRecorder) find(ch, key uint8) *mpeNote {
+	for _, n := range h.notes {
+		if n.ch == ch && n.key == key {
+			return n
+		}
+	}
+	return nil
+}
+
+func (h *mpeRecorder) NoteOnChannel(ch, key, vel uint8) {
+	h.notes = append(h.notes, &mpeNote{ch: ch, key: key, on: true})
+}
+
+func (h *mpeRecorder) NoteOffChannel(ch, key uint8) {
+	if n := h.find(ch, key); n != nil {
+		n.on = false
+	}
+}
+
+func (h *mpeRecorder) Expression(ch, key uint8, bend, pressure, timbre float32) {
+	if n := h.find(ch, key); n != nil {
+		n.bend = bend
+	}
+}
+
+func TestMPE(t *testing.T) {
+	r := newTestRig(t, 0)
+	h := &mpeRecorder{}
+	r.iface.MPE(h)
+
+	// The same key on member channels 1 and 2.
+	r.send(0, 0x91, 60, 100)
+	r.send(0, 0x92, 60, 100)
+	r.send(0, 0xe1, 0x7f, 0x7f) // full bend up on channel 1
+	r.send(0, 0xe0, 0x00, 0x60) // half master bend up
+	r.send(0, 0x82, 60, 0)
+
+	a, b := h.find(1, 60), h.find(2, 60)
+	if a == nil || b == nil || len(h.notes) != 2 {
+		t.Fatalf("got notes %v, want channels 1 and 2", h.notes)
+	}
+	if !a.on || b.on {
+		t.Errorf("got on %v %v, want true false", a.on, b.on)
+	}
+	// Member bend range of 48 semitones and master bend range of 2.
+	want := float32(48*8191)/8192 + 1
+	if a.bend != want {
+		t.Errorf("got bend %v, want %v", a.bend, want)
+	}
+	if b.bend != 1 {
+		t.Errorf("got bend %v, want the master bend 1", b.bend)
+	}
+
+	// Configure an upper zone with an MPE Configuration Message
+	// on its master channel 15.
+	r.send(0, 0xbf, rpnMSB, 0)
+	r.send(0, 0xbf, rpnLSB, rpnMCM)
+	r.send(0, 0xbf, dataEntryMSB, 3)
+	lower, upper := r.iface.handlers().mpe[0].Zones()
+	if lower.Members != 11 || upper.Members != 3 {
+		t.Errorf("got zones %d %d, want 11 3", lower.Members, upper.Members)
+	}
+}
@@ -0,0 +1,246 @@
+package midi
+
+import "sync"
+
+// MPEHandler handles notes with per-note expression.
+//
+// Notes are identified by their channel and key, so notes on the
+// same key on different member channels are independent.
+// Handlers are called from the MIDI reader goroutine.
+type MPEHandler interface {
+	// NoteOnChannel starts the note key on channel ch.
+	NoteOnChannel(ch, key, vel uint8)
+
+	// NoteOffChannel releases the note key on channel ch.
+	NoteOffChannel(ch, key uint8)
+
+	// Expression sets the expression of the note key on channel ch.
+	//
+	// bend is in semitones including the zone master bend.
+	// pressure and timbre are in the range 0 to 1.
+	// Expression is called after NoteOnChannel with the initial expression.
+	Expression(ch, key uint8, bend, pressure, timbre float32)
+}
+
+// Zone is an MPE zone.
+type Zone struct {
+	// Members is the number of member channels or 0 if the zone is disabled.
+	Members int
+	// BendRange is the pitch bend range of member channels in semitones.
+	BendRange float32
+	// MasterBendRange is the pitch bend range of the master channel in semitones.
+	MasterBendRange float32
+}
+
+// timbreCC is the controller for the MPE timbre dimension.
+const timbreCC = 74
+
+// mpeChannel is the expression state of a channel.
+type mpeChannel struct {
+	key      uint8
+	active   bool
+	bend     int16
+	pressure uint8
+	timbre   uint8
+
+	rpn   uint16 // selected RPN
+	isRPN bool
+}
+
+// MPE decodes MIDI Polyphonic Expression on an interface.
+//
+// The lower zone uses channel 1 as master channel and the channels above
+// as member channels. The upper zone uses channel 16 as master channel and
+// the channels below. Zones are configured with SetZones or by MPE
+// Configuration Messages. The interface channel does not apply.
+//
+// Notes may also be played on master channels and use the master bend.
+type MPE struct {
+	mu    sync.Mutex
+	h     MPEHandler
+	zones [2]Zone // lower and upper
+	chans [16]mpeChannel
+}
+
+// MPE returns an MPE decoder forwarding notes and expression to h.
+//
+// The default is a lower zone with 15 member channels, a member bend
+// range of 48 semitones and a master bend range of 2 semitones.
+func (i *Interface) MPE(h MPEHandler) *MPE {
+	m := &MPE{h: h}
+	for ch := range m.chans {
+		m.chans[ch].timbre = 64
+	}
+	m.SetZones(15, 0)
+	i.updateHandlers(func(hs *handlers) { hs.mpe = append(hs.mpe, m) })
+	return m
+}
+
+// SetZones sets the number of member channels of the lower and upper zones.
+//
+// The zones are reset to the default bend ranges. The lower zone takes
+// precedence when the zones overlap.
+func (m *MPE) SetZones(lower, upper int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setZone(1, upper)
+	m.setZone(0, lower)
+}
+
+func (m *MPE) setZone(z, members int) {
+	if members < 0 {
+		members = 0
+	}
+	if members > 15 {
+		members = 15
+	}
+	m.zones[z] = Zone{Members: members, BendRange: 48, MasterBendRange: 2}
+	// Shrink the other zone to make room.
+	if o := &m.zones[1-z]; o.Members+members > 14 && members > 0 && o.Members > 0 {
+		o.Members = 14 - members
+		if o.Members < 0 {
+			o.Members = 0
+		}
+	}
+}
+
+// Zones returns the lower and upper zone.
+func (m *MPE) Zones() (lower, upper Zone) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.zones[0], m.zones[1]
+}
+
+// zone returns the zone of channel ch and whether ch is its master channel.
+func (m *MPE) zone(ch uint8) (z int, isMaster, ok bool) {
+	if lo := m.zones[0]; lo.Members > 0 && int(ch) <= lo.Members {
+		return 0, ch == 0, true
+	}
+	if up := m.zones[1]; up.Members > 0 && int(ch) >= 15-up.Members {
+		return 1, ch == 15, true
+	}
+	return 0, false, false
+}
+
+// master returns the master channel of zone z.
+func master(z int) uint8 {
+	if z == 0 {
+		return 0
+	}
+	return 15
+}
+
+func (m *MPE) expression(ch uint8) {
+	c := &m.chans[ch]
+	if !c.active {
+		return
+	}
+	z, isMaster, _ := m.zone(ch)
+	zone := m.zones[z]
+	mc := &m.chans[master(z)]
+	bend := zone.MasterBendRange * float32(mc.bend) / 8192
+	if !isMaster {
+		bend += zone.BendRange * float32(c.bend) / 8192
+	}
+	m.h.Expression(ch, c.key, bend, float32(c.pressure)/127, float32(c.timbre)/127)
+}
+
+// handle decodes the event ev.
+func (m *MPE) handle(ev event) {
+	if ev.system() {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := ev.ch & 0xf
+	z, isMaster, ok := m.zone(ch)
+	c := &m.chans[ch]
+	if ev.kind == controlChangeEvent && m.rpn(ch, ev.a, ev.b) {
+		return
+	}
+	if !ok {
+		return
+	}
+	switch ev.kind {
+	case noteOnEvent:
+		if c.active {
+			m.h.NoteOffChannel(ch, c.key)
+		}
+		c.key, c.active = ev.a, true
+		m.h.NoteOnChannel(ch, ev.a, ev.b)
+		m.expression(ch)
+	case noteOffEvent:
+		if c.active && c.key == ev.a {
+			c.active = false
+			m.h.NoteOffChannel(ch, ev.a)
+		}
+	case pitchBendEvent:
+		c.bend = ev.bend
+		if !isMaster {
+			m.expression(ch)
+			return
+		}
+		// The master bend applies to every note in the zone.
+		for i := range m.chans {
+			if cz, _, ok := m.zone(uint8(i)); ok && cz == z {
+				m.expression(uint8(i))
+			}
+		}
+	case aftertouchEvent:
+		c.pressure = ev.a
+		m.expression(ch)
+	case controlChangeEvent:
+		if ev.a == timbreCC {
+			c.timbre = ev.b
+			m.expression(ch)
+		}
+	}
+}
+
+// RPN numbers used by MPE.
+const (
+	rpnBendRange = 0
+	rpnMCM       = 6
+)
+
+// rpn handles registered parameter controllers on channel ch.
+//
+// It returns true if the controller was consumed.
+func (m *MPE) rpn(ch, n, v uint8) bool {
+	c := &m.chans[ch]
+	switch n {
+	case rpnMSB:
+		c.rpn = uint16(v)<<7 | c.rpn&0x7f
+		c.isRPN = true
+	case rpnLSB:
+		c.rpn = c.rpn&^0x7f | uint16(v)
+		c.isRPN = true
+	case nrpnMSB, nrpnLSB:
+		c.isRPN = false
+	case dataEntryMSB:
+		if !c.isRPN {
+			return false
+		}
+		switch c.rpn {
+		case rpnMCM:
+			if ch == 0 {
+				m.setZone(0, int(v))
+			} else if ch == 15 {
+				m.setZone(1, int(v))
+			}
+		case rpnBendRange:
+			z, isMaster, ok := m.zone(ch)
+			if !ok {
+				break
+			}
+			if isMaster {
+				m.zones[z].MasterBendRange = float32(v)
+			} else {
+				m.zones[z].BendRange = float32(v)
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
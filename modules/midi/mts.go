@@ -0,0 +1,257 @@
+package midi
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ajzaff/go-modular/midi"
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// MIDI Tuning Standard sysex constants.
+const (
+	sysexNonRealtime = 0x7e
+	sysexRealtime    = 0x7f
+	sysexAllDevices  = 0x7f
+	mtsID            = 0x08
+	mtsBulkDump      = 0x01
+	mtsNoteChange    = 0x02
+	mtsBankChange    = 0x07
+
+	// mtsDumpLen is the length of a bulk dump without F0 and F7.
+	mtsDumpLen = 5 + 16 + 3*128 + 1
+)
+
+// MTSTuning is a tuning table retuned live by MIDI Tuning Standard messages.
+//
+// MTSTuning implements midi.KeyTuning and is safe for concurrent use.
+// Bulk dumps and single note tuning changes for the tuning program
+// are applied when received by an interface.
+type MTSTuning struct {
+	hz   [128]uint32 // float32 bits
+	prog int32       // tuning program or -1 for any
+	dev  uint32      // device id or sysexAllDevices
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewMTSTuning returns a new tuning initialized with the tuning t.
+func NewMTSTuning(t midi.Tuning) *MTSTuning {
+	r := &MTSTuning{prog: -1, dev: sysexAllDevices}
+	r.Set(midi.NewTable(t))
+	return r
+}
+
+// MTS applies MTS messages received by the interface to t.
+func (i *Interface) MTS(t *MTSTuning) {
+	i.updateHandlers(func(hs *handlers) { hs.tunings = append(hs.tunings, t) })
+}
+
+// Err returns the first error decoding an MTS message, if any.
+//
+// Malformed messages are otherwise ignored.
+func (t *MTSTuning) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// SetProgram sets the tuning program to accept or -1 to accept any program.
+//
+// The default is -1.
+func (t *MTSTuning) SetProgram(prog int) {
+	atomic.StoreInt32(&t.prog, int32(prog))
+}
+
+// SetDevice sets the sysex device id to accept.
+//
+// Messages to all devices (0x7f) are always accepted.
+// The default is 0x7f.
+func (t *MTSTuning) SetDevice(id uint8) {
+	atomic.StoreUint32(&t.dev, uint32(id&0x7f))
+}
+
+// A4Hz returns the frequency of key 69.
+func (t *MTSTuning) A4Hz() float32 {
+	return t.key(69)
+}
+
+// Hz returns the frequency of the fractional key.
+func (t *MTSTuning) Hz(key float32) float32 {
+	return midi.TableHz(t.key, key)
+}
+
+func (t *MTSTuning) key(k int) float32 {
+	return math.Float32frombits(atomic.LoadUint32(&t.hz[k]))
+}
+
+func (t *MTSTuning) setKey(k int, hz float32) {
+	atomic.StoreUint32(&t.hz[k], math.Float32bits(hz))
+}
+
+// Table returns a copy of the tuning table.
+func (t *MTSTuning) Table() *midi.Table {
+	var tab midi.Table
+	for k := range tab {
+		tab[k] = t.key(k)
+	}
+	return &tab
+}
+
+// Set sets the tuning table.
+func (t *MTSTuning) Set(tab *midi.Table) {
+	for k, hz := range tab {
+		t.setKey(k, hz)
+	}
+}
+
+// mtsHz returns the frequency of MTS frequency data.
+//
+// ok is false for the reserved no change value.
+func mtsHz(b []byte) (hz float32, ok bool) {
+	if b[0] == 0x7f && b[1] == 0x7f && b[2] == 0x7f {
+		return 0, false
+	}
+	semis := float64(b[0]&0x7f) + float64(uint16(b[1]&0x7f)<<7|uint16(b[2]&0x7f))/16384
+	return float32(440 * math.Exp2((semis-69)/12)), true
+}
+
+// mtsData returns the MTS frequency data of hz.
+func mtsData(hz float32) [3]byte {
+	if hz <= 0 {
+		return [3]byte{0x7f, 0x7f, 0x7f}
+	}
+	semis := 69 + 12*math.Log2(float64(hz)/440)
+	if semis < 0 {
+		semis = 0
+	}
+	n := int(math.Floor(semis))
+	frac := int(math.Round((semis - float64(n)) * 16384))
+	if frac >= 16384 {
+		n, frac = n+1, 0
+	}
+	if n > 127 || n == 127 && frac > 16382 {
+		// 7f 7f 7f is reserved.
+		n, frac = 127, 16382
+	}
+	return [3]byte{byte(n), byte(frac >> 7), byte(frac & 0x7f)}
+}
+
+// accepts returns true if the message for device dev and program prog applies.
+func (t *MTSTuning) accepts(dev, prog byte) bool {
+	if d := atomic.LoadUint32(&t.dev); dev != sysexAllDevices && uint32(dev) != d {
+		return false
+	}
+	p := atomic.LoadInt32(&t.prog)
+	return p < 0 || int32(prog) == p
+}
+
+// handleSysEx applies the MTS message data without F0 and F7
+// and records the first decoding error.
+func (t *MTSTuning) handleSysEx(data []byte) {
+	if err := t.decode(data); err != nil {
+		t.mu.Lock()
+		if t.err == nil {
+			t.err = err
+		}
+		t.mu.Unlock()
+	}
+}
+
+// decode applies the MTS message data.
+//
+// It returns an error for malformed MTS messages and
+// ignores other messages.
+func (t *MTSTuning) decode(data []byte) error {
+	if len(data) < 4 || data[2] != mtsID {
+		return nil
+	}
+	realtime := data[0] == sysexRealtime
+	if !realtime && data[0] != sysexNonRealtime {
+		return nil
+	}
+	dev := data[1]
+	switch sub := data[3]; {
+	case sub == mtsBulkDump && !realtime:
+		if len(data) != mtsDumpLen {
+			return fmt.Errorf("midi.MTSTuning: bulk dump length %d, want %d", len(data), mtsDumpLen)
+		}
+		var sum byte
+		for _, b := range data[:len(data)-1] {
+			sum ^= b
+		}
+		if sum&0x7f != data[len(data)-1] {
+			return fmt.Errorf("midi.MTSTuning: bulk dump checksum mismatch")
+		}
+		if !t.accepts(dev, data[4]) {
+			return nil
+		}
+		freqs := data[5+16:]
+		for k := 0; k < 128; k++ {
+			if hz, ok := mtsHz(freqs[3*k:]); ok {
+				t.setKey(k, hz)
+			}
+		}
+	case sub == mtsNoteChange && realtime, sub == mtsBankChange:
+		body := data[4:]
+		if sub == mtsBankChange {
+			// Skip the bank.
+			if len(body) < 1 {
+				return fmt.Errorf("midi.MTSTuning: short note change")
+			}
+			body = body[1:]
+		}
+		if len(body) < 2 {
+			return fmt.Errorf("midi.MTSTuning: short note change")
+		}
+		prog, n := body[0], int(body[1])
+		changes := body[2:]
+		if len(changes) < 4*n {
+			return fmt.Errorf("midi.MTSTuning: note change has %d bytes for %d notes", len(changes), n)
+		}
+		if !t.accepts(dev, prog) {
+			return nil
+		}
+		for j := 0; j < n; j++ {
+			c := changes[4*j:]
+			if hz, ok := mtsHz(c[1:4]); ok {
+				t.setKey(int(c[0]&0x7f), hz)
+			}
+		}
+	}
+	return nil
+}
+
+// MTSDump returns an MTS bulk tuning dump of the tuning t without F0 and F7.
+//
+// name is truncated or padded to 16 characters. Keys with frequency 0
+// are sent as unchanged.
+func MTSDump(t midi.Tuning, prog uint8, name string) []byte {
+	data := make([]byte, 0, mtsDumpLen)
+	data = append(data, sysexNonRealtime, sysexAllDevices, mtsID, mtsBulkDump, prog&0x7f)
+	for j := 0; j < 16; j++ {
+		c := byte(' ')
+		if j < len(name) && name[j] < 0x80 {
+			c = name[j]
+		}
+		data = append(data, c)
+	}
+	for k := 0; k < 128; k++ {
+		f := mtsData(midi.Pitch(t, k))
+		data = append(data, f[:]...)
+	}
+	var sum byte
+	for _, b := range data {
+		sum ^= b
+	}
+	return append(data, sum&0x7f)
+}
+
+// SendTuning sends an MTS bulk tuning dump of the tuning t.
+func (o *Output) SendTuning(t midi.Tuning, prog uint8, name string) {
+	data := MTSDump(t, prog, name)
+	o.write(func(w *writer.Writer) error { return writer.SysEx(w, data) })
+}
@@ -0,0 +1,178 @@
+package midi
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/ajzaff/go-modular/midi"
+)
+
+// centsOff returns the distance between a and b in cents.
+func centsOff(a, b float32) float64 {
+	return math.Abs(1200 * math.Log2(float64(a)/float64(b)))
+}
+
+// sendSysEx sends the sysex message data without F0 and F7.
+func sendSysEx(t *testing.T, in *MemIn, data []byte) {
+	t.Helper()
+	msg := append(append([]byte{0xf0}, data...), 0xf7)
+	if err := in.Send(msg, 0); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+}
+
+func TestMTSDump(t *testing.T) {
+	data := MTSDump(midi.StdTuning, 3, "Equal")
+	if len(data) != 406 {
+		t.Fatalf("got dump length %d, want 406", len(data))
+	}
+	if want := []byte{0x7e, 0x7f, 0x08, 0x01, 3}; !bytes.Equal(data[:5], want) {
+		t.Errorf("got header % x, want % x", data[:5], want)
+	}
+	if name := string(data[5:21]); name != "Equal           " {
+		t.Errorf("got name %q, want padded name", name)
+	}
+	// A4 is exactly key 69.
+	if f := data[21+3*69 : 21+3*70]; !bytes.Equal(f, []byte{69, 0, 0}) {
+		t.Errorf("got A4 data % x, want 45 00 00", f)
+	}
+	var sum byte
+	for _, b := range data[:len(data)-1] {
+		sum ^= b
+	}
+	if data[len(data)-1] != sum&0x7f {
+		t.Errorf("got checksum %#x, want %#x", data[len(data)-1], sum&0x7f)
+	}
+	for _, b := range data {
+		if b > 0x7f {
+			t.Fatalf("got data byte %#x, want 7-bit data", b)
+		}
+	}
+}
+
+func TestMTSRoundTrip(t *testing.T) {
+	want, err := midi.JustIntonation().Table(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRig(t, 0)
+	mts := NewMTSTuning(midi.StdTuning)
+	r.iface.MTS(mts)
+	sendSysEx(t, r.in, MTSDump(want, 0, "Just"))
+	if err := mts.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	got := mts.Table()
+	for k := range want {
+		// The data resolution is 100/16384 cents.
+		if d := centsOff(got[k], want[k]); d > .01 {
+			t.Errorf("key %d: got %v Hz, want %v Hz (%.4f cents off)", k, got[k], want[k], d)
+		}
+	}
+	if d := centsOff(mts.Hz(69.5), want.Hz(69.5)); d > .01 {
+		t.Errorf("got fractional key %v Hz, want %v Hz", mts.Hz(69.5), want.Hz(69.5))
+	}
+}
+
+func TestMTSNoteChange(t *testing.T) {
+	r := newTestRig(t, 0)
+	mts := NewMTSTuning(midi.StdTuning)
+	r.iface.MTS(mts)
+
+	// Real-time single note change of key 60 to 50 cents above
+	// and of key 61 to the reserved no change value.
+	sendSysEx(t, r.in, []byte{0x7f, 0x7f, 0x08, 0x02, 0, 2, 60, 60, 0x40, 0, 61, 0x7f, 0x7f, 0x7f})
+	if err := mts.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if got, want := mts.Hz(60), midi.Tone(midi.StdTuning, 60.5); centsOff(got, want) > .01 {
+		t.Errorf("got key 60 %v Hz, want %v Hz", got, want)
+	}
+	if got, want := mts.Hz(61), midi.Pitch(midi.StdTuning, 61); got != want {
+		t.Errorf("got key 61 %v Hz, want unchanged %v Hz", got, want)
+	}
+}
+
+func TestMTSFilters(t *testing.T) {
+	r := newTestRig(t, 0)
+	mts := NewMTSTuning(midi.StdTuning)
+	mts.SetProgram(1)
+	mts.SetDevice(5)
+	r.iface.MTS(mts)
+
+	// change retunes A4 to key.
+	change := func(dev, prog, key byte) {
+		sendSysEx(t, r.in, []byte{0x7f, dev, 0x08, 0x02, prog, 1, 69, key, 0, 0})
+	}
+	for _, tc := range []struct {
+		name           string
+		dev, prog, key byte
+		want           float32
+	}{
+		{"other program", 5, 0, 70, 440},
+		{"other device", 6, 1, 70, 440},
+		{"matching", 5, 1, 70, midi.Pitch(midi.StdTuning, 70)},
+		{"all devices", 0x7f, 1, 71, midi.Pitch(midi.StdTuning, 71)},
+	} {
+		change(tc.dev, tc.prog, tc.key)
+		if got := mts.A4Hz(); centsOff(got, tc.want) > .01 {
+			t.Errorf("%s: got A4 %v Hz, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMTSErrors(t *testing.T) {
+	r := newTestRig(t, 0)
+	mts := NewMTSTuning(midi.StdTuning)
+	r.iface.MTS(mts)
+
+	// Other sysex messages are ignored.
+	sendSysEx(t, r.in, []byte{0x7e, 0x7f, 0x06, 0x01})
+	if err := mts.Err(); err != nil {
+		t.Fatalf("Err after unrelated sysex: %v", err)
+	}
+
+	tab, err := midi.EDO(19).Table(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := MTSDump(tab, 0, "19-EDO")
+	data[len(data)-1] ^= 1
+	sendSysEx(t, r.in, data)
+	if mts.Err() == nil {
+		t.Errorf("got nil error after a bad checksum")
+	}
+	if got := mts.Hz(70); got != midi.Pitch(midi.StdTuning, 70) {
+		t.Errorf("got key 70 %v Hz after a bad checksum, want unchanged", got)
+	}
+
+	// The first error is kept.
+	first := mts.Err()
+	sendSysEx(t, r.in, []byte{0x7f, 0x7f, 0x08, 0x02, 0, 2, 60})
+	if err := mts.Err(); err != first {
+		t.Errorf("got error %v, want the first error %v", err, first)
+	}
+}
+
+func TestSendTuning(t *testing.T) {
+	drv := NewMemDriver("test")
+	out := drv.AddOut("out")
+	o, err := NewOut(out, 0)
+	if err != nil {
+		t.Fatalf("NewOut: %v", err)
+	}
+	defer o.Close()
+	o.SendTuning(midi.StdTuning, 0, "Equal")
+	if err := o.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	msgs := out.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	want := append(append([]byte{0xf0}, MTSDump(midi.StdTuning, 0, "Equal")...), 0xf7)
+	if !bytes.Equal(msgs[0], want) {
+		t.Errorf("got message % x, want % x", msgs[0], want)
+	}
+}
@@ -0,0 +1,255 @@
+package midi
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/ajzaff/go-modular"
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/writer"
+	"gitlab.com/gomidi/rtmididrv"
+)
+
+// Output sends MIDI messages on the single midi output channel (o, ch).
+//
+// Output implements NoteHandler so it can be fed from an Interface,
+// a Player or a sequencer. Messages are sent immediately. The first
+// write error is kept and returned by Err.
+//
+// The output owns its port and should be closed when done.
+type Output struct {
+	out midi.Out
+	drv midi.Driver
+
+	mu     sync.Mutex
+	w      *writer.Writer
+	closed bool
+	err    error
+}
+
+// NewOutput creates a new midi output on port i MIDI channel ch
+// using the default rtmidi driver.
+func NewOutput(i, ch uint8) (*Output, error) {
+	drv, err := rtmididrv.New()
+	if err != nil {
+		return nil, fmt.Errorf("midi.NewOutput: %v", err)
+	}
+	out, err := Out(drv, int(i))
+	if err != nil {
+		drv.Close()
+		return nil, fmt.Errorf("midi.NewOutput: %v", err)
+	}
+	o, err := NewOut(out, ch)
+	if err != nil {
+		drv.Close()
+		return nil, fmt.Errorf("midi.NewOutput: %v", err)
+	}
+	o.drv = drv
+	return o, nil
+}
+
+// NewOut creates a new midi output on the port out MIDI channel ch.
+//
+// The port is opened if needed and closed by Close. See Out and
+// OutNamed to look up ports of a driver.
+func NewOut(out midi.Out, ch uint8) (*Output, error) {
+	if !out.IsOpen() {
+		if err := out.Open(); err != nil {
+			return nil, fmt.Errorf("midi.NewOut: %v", err)
+		}
+	}
+	w := writer.New(out)
+	w.SetChannel(ch)
+	return &Output{out: out, w: w}, nil
+}
+
+// Close closes the output port and the driver if it was opened by NewOutput.
+//
+// Calling Close more than once has no effect.
+func (o *Output) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	err := o.out.Close()
+	if o.drv != nil {
+		if err2 := o.drv.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("midi.Output.Close: %v", err)
+	}
+	return nil
+}
+
+// Err returns the first error writing to the output.
+func (o *Output) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.err
+}
+
+// write calls fn with the writer and records the first error.
+func (o *Output) write(fn func(w *writer.Writer) error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return
+	}
+	if o.closed {
+		o.err = fmt.Errorf("midi.Output: %v", midi.ErrPortClosed)
+		return
+	}
+	if err := fn(o.w); err != nil {
+		o.err = fmt.Errorf("midi.Output: %v", err)
+	}
+}
+
+// NoteOn sends a Note On message.
+func (o *Output) NoteOn(key, vel uint8) {
+	o.write(func(w *writer.Writer) error { return writer.NoteOn(w, key, vel) })
+}
+
+// NoteOff sends a Note Off message.
+func (o *Output) NoteOff(key uint8) {
+	o.write(func(w *writer.Writer) error { return writer.NoteOffVelocity(w, key, 0) })
+}
+
+// PitchBend sends a pitch bend message in the range -8192 to 8191.
+func (o *Output) PitchBend(value int16) {
+	o.write(func(w *writer.Writer) error { return writer.Pitchbend(w, value) })
+}
+
+// Aftertouch sends a channel pressure message.
+func (o *Output) Aftertouch(pressure uint8) {
+	o.write(func(w *writer.Writer) error { return writer.Aftertouch(w, pressure) })
+}
+
+// CC sends a control change message for controller n.
+func (o *Output) CC(n, value uint8) {
+	o.write(func(w *writer.Writer) error { return writer.ControlChange(w, n, value) })
+}
+
+// NoteCV returns a processor converting gate CV blocks to notes.
+//
+// A note starts on the rising edge of the gate and stops on the
+// falling edge. The pitch and velocity closures are called for
+// every sample.
+func (o *Output) NoteCV() *NoteCV {
+	return &NoteCV{
+		Pitch: func() float32 { return 5 },
+		Vel:   func() float32 { return 100. / 127 },
+		o:     o,
+		key:   -1,
+	}
+}
+
+// NoteCV converts gate, pitch and velocity CV to notes.
+type NoteCV struct {
+	// Pitch closure.
+	//
+	// Using the one-volt-per-octave standard (e.g.: 0 = MIDI 0, 5 = MIDI 60).
+	// The pitch is rounded to the nearest key.
+	Pitch func() float32
+	// Velocity closure in the range 0 to 1.
+	Vel func() float32
+	// Legato sends a new note when the key changes while the gate is high.
+	Legato bool
+
+	o   *Output
+	key int
+}
+
+// Next updates the note from the gate v.
+func (n *NoteCV) Next(v float32) {
+	key := clampKey(math.Round(float64(n.Pitch()) * 12))
+	vel := clampKey(math.Round(float64(n.Vel()) * 127))
+	switch {
+	case v > 0 && n.key < 0:
+		n.noteOn(key, vel)
+	case v > 0 && n.Legato && key != n.key:
+		// Overlap the notes for legato on the receiver.
+		old := n.key
+		n.noteOn(key, vel)
+		n.o.NoteOff(uint8(old))
+	case v <= 0 && n.key >= 0:
+		n.Release()
+	}
+}
+
+func (n *NoteCV) noteOn(key, vel int) {
+	if vel == 0 {
+		vel = 1
+	}
+	n.key = key
+	n.o.NoteOn(uint8(key), uint8(vel))
+}
+
+// Release stops the playing note.
+func (n *NoteCV) Release() {
+	if n.key >= 0 {
+		n.o.NoteOff(uint8(n.key))
+		n.key = -1
+	}
+}
+
+// Process reads the gate block b.
+func (n *NoteCV) Process(b []float32) {
+	for _, v := range b {
+		n.Next(v)
+	}
+}
+
+func clampKey(v float64) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 127 {
+		return 127
+	}
+	return int(v)
+}
+
+// ctlCV sends the last value of each block when it changes.
+type ctlCV struct {
+	send func(v int)
+	conv func(v float32) int
+	last int
+}
+
+func (c *ctlCV) Process(b []float32) {
+	if len(b) == 0 {
+		return
+	}
+	if v := c.conv(b[len(b)-1]); v != c.last {
+		c.last = v
+		c.send(v)
+	}
+}
+
+// Bend returns a processor sending pitch bend CV blocks in the range -1 to 1.
+//
+// The last sample of each block is sent when it changes.
+func (o *Output) Bend() modular.Processor {
+	return &ctlCV{
+		send: func(v int) { o.PitchBend(int16(v)) },
+		conv: func(v float32) int {
+			return int(math.Max(-8192, math.Min(8191, math.Round(float64(v)*8192))))
+		},
+	}
+}
+
+// Control returns a processor sending CV blocks in the range 0 to 1 to controller n.
+//
+// The last sample of each block is sent when it changes.
+func (o *Output) Control(n uint8) modular.Processor {
+	return &ctlCV{
+		send: func(v int) { o.CC(n, uint8(v)) },
+		conv: func(v float32) int { return clampKey(math.Round(float64(v) * 127)) },
+		last: -1,
+	}
+}
@@ -0,0 +1,380 @@
+package midi
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/ajzaff/go-modular"
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/reader"
+	"gitlab.com/gomidi/midi/smf"
+)
+
+// AllChannels selects events on every MIDI channel.
+//
+// Notes on all channels share a single held note stack.
+const AllChannels = -1
+
+type smfEvent struct {
+	event
+	sec   float64
+	pos   int64
+	track int16
+}
+
+// Player plays a Standard MIDI File as MIDI CVs for offline rendering.
+//
+// Player provides the same outputs as Interface. Events are applied at
+// their exact sample positions within each block, so a file renders
+// deterministically.
+//
+// Each output keeps its own position and should be processed
+// once per block. Reset rewinds every output.
+type Player struct {
+	events []smfEvent
+	length float64
+	ch     int
+	tracks []int16
+	loop   bool
+
+	set settings
+
+	hs      handlers
+	cursor  *smfCursor
+	cursors []*smfCursor
+
+	sampleRate int
+}
+
+// ReadSMF reads a type 0 or type 1 Standard MIDI File from src.
+func ReadSMF(src io.Reader) (*Player, error) {
+	type tempoChange struct {
+		ticks uint64
+		bpm   float64
+	}
+	type rawEvent struct {
+		ticks uint64
+		track int16
+		ev    event
+	}
+	var (
+		tempos []tempoChange
+		raws   []rawEvent
+		end    uint64
+	)
+	rd := reader.New(reader.NoLogger(),
+		reader.TempoBPM(func(p reader.Position, bpm float64) {
+			tempos = append(tempos, tempoChange{p.AbsoluteTicks, bpm})
+		}),
+		// The end of track position is reset before calling EndOfTrack
+		// so track the last message of any kind instead.
+		reader.Each(func(p *reader.Position, _ midi.Message) {
+			if p != nil && p.AbsoluteTicks > end {
+				end = p.AbsoluteTicks
+			}
+		}),
+	)
+	add := func(p *reader.Position, ev event) {
+		raws = append(raws, rawEvent{p.AbsoluteTicks, p.Track, ev})
+	}
+	rd.Channel.NoteOn = func(p *reader.Position, channel uint8, key uint8, velocity uint8) {
+		add(p, event{kind: noteOnEvent, ch: channel, a: key, b: velocity})
+	}
+	rd.Channel.NoteOff = func(p *reader.Position, channel uint8, key uint8, velocity uint8) {
+		add(p, event{kind: noteOffEvent, ch: channel, a: key, b: velocity})
+	}
+	rd.Channel.Pitchbend = func(p *reader.Position, channel uint8, value int16) {
+		add(p, event{kind: pitchBendEvent, ch: channel, bend: value})
+	}
+	rd.Channel.Aftertouch = func(p *reader.Position, channel uint8, pressure uint8) {
+		add(p, event{kind: aftertouchEvent, ch: channel, a: pressure})
+	}
+	rd.Channel.PolyAftertouch = func(p *reader.Position, channel uint8, key uint8, pressure uint8) {
+		add(p, event{kind: polyAftertouchEvent, ch: channel, a: key, b: pressure})
+	}
+	rd.Channel.ControlChange.Each = func(p *reader.Position, channel uint8, controller uint8, value uint8) {
+		add(p, event{kind: controlChangeEvent, ch: channel, a: controller, b: value})
+	}
+	if err := reader.ReadSMF(rd, src); err != nil {
+		return nil, fmt.Errorf("midi.ReadSMF: %v", err)
+	}
+	mt, ok := rd.Header().TimeFormat.(smf.MetricTicks)
+	if !ok || mt.Resolution() == 0 {
+		return nil, fmt.Errorf("midi.ReadSMF: unsupported time format")
+	}
+
+	// Convert ticks to seconds using the tempo map.
+	sort.SliceStable(tempos, func(i, j int) bool { return tempos[i].ticks < tempos[j].ticks })
+	res := float64(mt.Resolution())
+	seconds := func(ticks uint64) float64 {
+		var sec float64
+		last, bpm := uint64(0), 120.
+		for _, t := range tempos {
+			if t.ticks >= ticks {
+				break
+			}
+			sec += float64(t.ticks-last) / res * 60 / bpm
+			last, bpm = t.ticks, t.bpm
+		}
+		return sec + float64(ticks-last)/res*60/bpm
+	}
+
+	sort.SliceStable(raws, func(i, j int) bool { return raws[i].ticks < raws[j].ticks })
+	p := &Player{
+		events:     make([]smfEvent, len(raws)),
+		length:     seconds(end),
+		ch:         0,
+		set:        newSettings(),
+		sampleRate: 44100,
+	}
+	for i, r := range raws {
+		p.events[i] = smfEvent{event: r.ev, sec: seconds(r.ticks), track: r.track}
+	}
+	p.updatePos()
+	p.cursor = p.newCursor()
+	return p, nil
+}
+
+// ReadSMFFile reads a type 0 or type 1 Standard MIDI File from the named file.
+func ReadSMFFile(name string) (*Player, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("midi.ReadSMFFile: %v", err)
+	}
+	defer f.Close()
+	return ReadSMF(f)
+}
+
+func (p *Player) SetConfig(cfg *modular.Config) error {
+	p.sampleRate = cfg.SampleRate
+	p.updatePos()
+	return nil
+}
+
+func (p *Player) samples(sec float64) int64 {
+	return int64(math.Round(sec * float64(p.sampleRate)))
+}
+
+func (p *Player) updatePos() {
+	for i := range p.events {
+		p.events[i].pos = p.samples(p.events[i].sec)
+	}
+}
+
+// Len returns the length of the song in samples.
+func (p *Player) Len() int64 {
+	return p.samples(p.length)
+}
+
+// SetChannel selects the MIDI channel to play from 0 to 15 or AllChannels.
+//
+// The default is channel 0.
+func (p *Player) SetChannel(ch int) {
+	p.ch = ch
+}
+
+// SetTracks selects the tracks to play.
+//
+// No tracks selects all tracks, which is the default.
+func (p *Player) SetTracks(tracks ...int) {
+	p.tracks = p.tracks[:0]
+	for _, t := range tracks {
+		p.tracks = append(p.tracks, int16(t))
+	}
+}
+
+// SetLoop enables or disables looping at the end of the song.
+func (p *Player) SetLoop(loop bool) {
+	p.loop = loop
+}
+
+// SetBendRange sets the pitch bend range in semitones used by Pitch.
+//
+// The default is 2 semitones.
+func (p *Player) SetBendRange(semitones float32) {
+	p.set.bendRange = semitones
+}
+
+// SetPriority sets the note priority among held notes.
+//
+// The default is Last.
+func (p *Player) SetPriority(pr Priority) {
+	p.set.priority = pr
+}
+
+// SetLegato enables or disables legato mode.
+//
+// In legato mode the gate stays open when the playing note changes.
+// Otherwise the gate closes for one sample to retrigger envelopes.
+func (p *Player) SetLegato(legato bool) {
+	p.set.legato = legato
+}
+
+func (p *Player) selected(ev *smfEvent) bool {
+	if p.ch != AllChannels && int(ev.ch) != p.ch {
+		return false
+	}
+	if len(p.tracks) == 0 {
+		return true
+	}
+	for _, t := range p.tracks {
+		if t == ev.track {
+			return true
+		}
+	}
+	return false
+}
+
+// smfCursor is a play position in the song with its own channel state.
+type smfCursor struct {
+	p    *Player
+	pos  int64
+	next int
+	st   state
+}
+
+func (p *Player) newCursor() *smfCursor {
+	c := &smfCursor{p: p, st: newState()}
+	p.cursors = append(p.cursors, c)
+	return c
+}
+
+// rewind moves to the start of the song and resets the channel state.
+//
+// Held notes are released and passed to fn if not nil.
+func (c *smfCursor) rewind(fn func(ev event)) {
+	if fn != nil {
+		for _, n := range c.st.stack.notes {
+			fn(event{kind: noteOffEvent, a: n.key})
+		}
+	}
+	c.pos, c.next = 0, 0
+	c.st.reset()
+}
+
+// advance applies the events at the current sample and moves to the next sample.
+//
+// Note events are passed to fn if not nil.
+// The song rewinds at the end when looping.
+func (c *smfCursor) advance(fn func(ev event)) {
+	p := c.p
+	if p.loop && c.pos >= p.Len() && p.Len() > 0 {
+		c.rewind(fn)
+	}
+	c.st.configure(p.set)
+	for c.next < len(p.events) && p.events[c.next].pos <= c.pos {
+		ev := &p.events[c.next]
+		c.next++
+		if !p.selected(ev) {
+			continue
+		}
+		c.st.apply(ev.event)
+		if fn != nil {
+			fn(ev.event)
+		}
+	}
+	c.pos++
+}
+
+// Reset rewinds the song and all outputs to the start.
+//
+// Held notes are released and controllers are reset.
+func (p *Player) Reset() {
+	for _, c := range p.cursors {
+		var fn func(ev event)
+		if c == p.cursor {
+			fn = func(ev event) { ev.dispatch(&p.hs) }
+		}
+		c.rewind(fn)
+	}
+}
+
+// Pos returns the play position of Advance in samples.
+func (p *Player) Pos() int64 {
+	return p.cursor.pos
+}
+
+// Notes forwards note events to h when calling Advance.
+func (p *Player) Notes(h NoteHandler) {
+	p.hs.notes = append(p.hs.notes, h)
+}
+
+// Controls forwards control change events to h when calling Advance.
+func (p *Player) Controls(h ControlHandler) {
+	p.hs.controls = append(p.hs.controls, h)
+}
+
+// Advance advances the song by n samples and forwards events to the handlers.
+func (p *Player) Advance(n int) {
+	dispatch := func(ev event) {
+		ev.dispatch(&p.hs)
+	}
+	for i := 0; i < n; i++ {
+		p.cursor.advance(dispatch)
+	}
+}
+
+type smfProcessor struct {
+	c       *smfCursor
+	fn      func(s *state) float32
+	gate    bool
+	retrigs uint64
+}
+
+func (r *smfProcessor) Process(b []float32) {
+	for i := range b {
+		r.c.advance(nil)
+		v := r.fn(&r.c.st)
+		if r.gate && r.retrigs != r.c.st.retrigs {
+			r.retrigs = r.c.st.retrigs
+			v = 0
+		}
+		b[i] = v
+	}
+}
+
+func (p *Player) cv(fn func(s *state) float32) modular.Processor {
+	return &smfProcessor{c: p.newCursor(), fn: fn}
+}
+
+// GateKey returns processors for the gate and key of the playing note.
+//
+// The key CV is in volts at one volt per octave like Pitch, without pitch bend.
+func (p *Player) GateKey() (gate, key modular.Processor) {
+	return &smfProcessor{c: p.newCursor(), fn: gateCV, gate: true}, p.cv(keyCV)
+}
+
+// Vel returns the velocity CV of the last note in the range 0 to 1.
+func (p *Player) Vel() modular.Processor {
+	return p.cv(velCV)
+}
+
+// Bend returns the pitch bend CV in the range -1 to 1.
+func (p *Player) Bend() modular.Processor {
+	return p.cv(bendCV)
+}
+
+// Pitch returns the pitch CV of the last note with pitch bend applied.
+//
+// Pitch uses the one-volt-per-octave standard compatible with osc.Osc.Voltage.
+func (p *Player) Pitch() modular.Processor {
+	return p.cv(pitchCV)
+}
+
+// Aftertouch returns the channel pressure CV in the range 0 to 1.
+func (p *Player) Aftertouch() modular.Processor {
+	return p.cv(aftertouchCV)
+}
+
+// PolyAftertouch returns the polyphonic pressure CV of the last note in the range 0 to 1.
+func (p *Player) PolyAftertouch() modular.Processor {
+	return p.cv(polyAftertouchCV)
+}
+
+// CC returns the CV of controller n in the range 0 to 1.
+func (p *Player) CC(n uint8) modular.Processor {
+	return p.cv(ccCV(n))
+}
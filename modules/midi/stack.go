@@ -0,0 +1,79 @@
+package midi
+
+// Priority selects the playing note among held notes.
+type Priority int
+
+const (
+	Last    Priority = iota // most recently pressed
+	Lowest                  // lowest key
+	Highest                 // highest key
+)
+
+type heldNote struct {
+	key, vel uint8
+}
+
+// NoteStack tracks held notes for monophonic input.
+//
+// The zero value is an empty stack with Last priority.
+type NoteStack struct {
+	// Priority selects the playing note.
+	Priority Priority
+
+	notes []heldNote
+}
+
+// NoteOn pushes a held note.
+//
+// Pressing a held key again moves it to the top.
+func (s *NoteStack) NoteOn(key, vel uint8) {
+	s.remove(key)
+	s.notes = append(s.notes, heldNote{key, vel})
+}
+
+// NoteOff releases a held note.
+func (s *NoteStack) NoteOff(key uint8) {
+	s.remove(key)
+}
+
+func (s *NoteStack) remove(key uint8) {
+	for i, n := range s.notes {
+		if n.key == key {
+			s.notes = append(s.notes[:i], s.notes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Reset releases all notes.
+func (s *NoteStack) Reset() {
+	s.notes = s.notes[:0]
+}
+
+// Len returns the number of held notes.
+func (s *NoteStack) Len() int {
+	return len(s.notes)
+}
+
+// Top returns the playing note according to the priority.
+//
+// ok is false if no notes are held.
+func (s *NoteStack) Top() (key, vel uint8, ok bool) {
+	if len(s.notes) == 0 {
+		return 0, 0, false
+	}
+	top := s.notes[len(s.notes)-1]
+	for _, n := range s.notes {
+		switch s.Priority {
+		case Lowest:
+			if n.key < top.key {
+				top = n
+			}
+		case Highest:
+			if n.key > top.key {
+				top = n
+			}
+		}
+	}
+	return top.key, top.vel, true
+}
@@ -0,0 +1,173 @@
+package midi
+
+type eventKind uint8
+
+const (
+	noteOnEvent eventKind = iota
+	noteOffEvent
+	pitchBendEvent
+	aftertouchEvent
+	polyAftertouchEvent
+	controlChangeEvent
+
+	// System events are not filtered by channel.
+	clockEvent
+	startEvent
+	stopEvent
+	continueEvent
+	songPositionEvent
+)
+
+// event is a MIDI channel message.
+type event struct {
+	kind eventKind
+	ch   uint8
+	a, b uint8 // key, controller or pressure and velocity or value
+	bend int16
+	spp  uint16 // song position in sixteenth notes
+}
+
+// system returns true for system events without a channel.
+func (ev event) system() bool {
+	return ev.kind >= clockEvent
+}
+
+// handlers are the handlers of forwarded events.
+type handlers struct {
+	notes    []NoteHandler
+	controls []ControlHandler
+	mpe      []*MPE // decoders for all channels
+	tunings  []*MTSTuning
+}
+
+// clone returns a copy of hs not sharing handler lists.
+func (hs *handlers) clone() *handlers {
+	return &handlers{
+		notes:    append([]NoteHandler(nil), hs.notes...),
+		controls: append([]ControlHandler(nil), hs.controls...),
+		mpe:      append([]*MPE(nil), hs.mpe...),
+		tunings:  append([]*MTSTuning(nil), hs.tunings...),
+	}
+}
+
+// dispatch forwards note and control events to the handlers hs.
+func (ev event) dispatch(hs *handlers) {
+	switch ev.kind {
+	case noteOnEvent:
+		for _, h := range hs.notes {
+			h.NoteOn(ev.a, ev.b)
+		}
+	case noteOffEvent:
+		for _, h := range hs.notes {
+			h.NoteOff(ev.a)
+		}
+	case controlChangeEvent:
+		for _, h := range hs.controls {
+			h.ControlChange(ev.ch, ev.a, ev.b)
+		}
+	}
+}
+
+// state is the CV state of a single MIDI channel.
+type state struct {
+	stack     NoteStack
+	legato    bool
+	retrigs   uint64 // counts gate closings including retriggers
+	gate      float32
+	key       uint8
+	vel       uint8
+	bend      int16
+	bendRange float32
+	pressure  uint8
+	poly      [128]uint8
+	cc        [128]uint8
+}
+
+func newState() state {
+	return state{bendRange: 2}
+}
+
+// settings are the user settings applied to a state.
+type settings struct {
+	priority  Priority
+	legato    bool
+	bendRange float32
+}
+
+func newSettings() settings {
+	return settings{bendRange: 2}
+}
+
+// configure applies the settings set.
+func (s *state) configure(set settings) {
+	s.legato, s.bendRange = set.legato, set.bendRange
+	if s.stack.Priority != set.priority {
+		s.stack.Priority = set.priority
+		s.update()
+	}
+}
+
+// copyFrom sets s to a copy of src reusing the held note buffer of s.
+func (s *state) copyFrom(src *state) {
+	notes := s.stack.notes[:0]
+	*s = *src
+	s.stack.notes = append(notes, src.stack.notes...)
+}
+
+// apply updates the state with the event ev.
+func (s *state) apply(ev event) {
+	switch ev.kind {
+	case noteOnEvent:
+		s.stack.NoteOn(ev.a, ev.b)
+		s.update()
+	case noteOffEvent:
+		s.stack.NoteOff(ev.a)
+		s.update()
+	case pitchBendEvent:
+		s.bend = ev.bend
+	case aftertouchEvent:
+		s.pressure = ev.a
+	case polyAftertouchEvent:
+		s.poly[ev.a&0x7f] = ev.b
+	case controlChangeEvent:
+		s.cc[ev.a&0x7f] = ev.b
+	}
+}
+
+// update sets the playing note from the held note stack.
+func (s *state) update() {
+	key, vel, ok := s.stack.Top()
+	if !ok {
+		if s.gate != 0 {
+			s.retrigs++
+		}
+		s.gate = 0
+		return
+	}
+	if s.gate != 0 && key != s.key && !s.legato {
+		s.retrigs++
+	}
+	s.key, s.vel, s.gate = key, vel, 1
+}
+
+// reset releases all notes and resets the controllers.
+//
+// The last key and velocity are kept for release tails
+// and gate retriggers are still counted.
+func (s *state) reset() {
+	s.stack.Reset()
+	s.update()
+	*s = state{
+		stack:     s.stack,
+		legato:    s.legato,
+		retrigs:   s.retrigs,
+		key:       s.key,
+		vel:       s.vel,
+		bendRange: s.bendRange,
+	}
+}
+
+// pitch returns the pitch CV of the playing note with pitch bend applied.
+func (s *state) pitch() float32 {
+	return (float32(s.key) + s.bendRange*float32(s.bend)/8192) / 12
+}
@@ -0,0 +1,214 @@
+package midi
+
+import (
+	"math"
+
+	"github.com/ajzaff/go-modular"
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// PPQN is the resolution of MIDI clock in pulses per quarter note.
+const PPQN = 24
+
+// swap7 swaps the 7-bit halves of the 14-bit value v.
+//
+// gomidi reads and writes Song Position Pointer with the most significant
+// byte first while MIDI sends the least significant byte first.
+func swap7(v uint16) uint16 {
+	return v&0x7f<<7 | v>>7&0x7f
+}
+
+// Sync follows MIDI clock and transport messages on an interface.
+//
+// Sync derives a smoothed tempo from the clock and starts, stops and
+// seeks the transport on Start, Stop, Continue and Song Position Pointer
+// messages. Sync is a processor writing a trigger on every clock pulse.
+type Sync struct {
+	iface *Interface
+	n     int64
+	t     *modular.Transport
+
+	smooth float64
+	period float64 // smoothed clock period in samples
+	pos    int64   // samples processed
+	last   int64   // sample of the last clock or -1
+	clocks int64   // clocks since the song position less one
+	start  float64 // song position in beats
+	locked bool
+
+	sampleRate int
+}
+
+// Sync returns a processor syncing the transport t to the interface clock.
+//
+// The transport tempo is only changed after clocks are received.
+func (i *Interface) Sync(t *modular.Transport) *Sync {
+	i.addProcessor()
+	return &Sync{iface: i, t: t, smooth: .1, last: -1, clocks: -1, sampleRate: 44100}
+}
+
+func (s *Sync) SetConfig(cfg *modular.Config) error {
+	s.sampleRate = cfg.SampleRate
+	return nil
+}
+
+// SetSmoothing sets the tempo smoothing amount in the range 0 to 1.
+//
+// Zero follows every clock interval. The default is 0.9.
+func (s *Sync) SetSmoothing(amount float64) {
+	s.smooth = 1 - amount
+}
+
+// Tempo returns the smoothed tempo in beats per minute or 0 without clock.
+func (s *Sync) Tempo() float64 {
+	if s.period == 0 {
+		return 0
+	}
+	return 60 * float64(s.sampleRate) / (PPQN * s.period)
+}
+
+// Locked returns true once the tempo was derived from the clock.
+func (s *Sync) Locked() bool {
+	return s.locked
+}
+
+func (s *Sync) clock(at int64, off int) {
+	if s.last >= 0 {
+		d := float64(at - s.last)
+		if s.period == 0 {
+			s.period = d
+		} else {
+			s.period += s.smooth * (d - s.period)
+		}
+		if s.period > 0 {
+			s.t.SetTempo(s.Tempo())
+			s.locked = true
+		}
+	}
+	s.last = at
+	if !s.t.Playing() {
+		return
+	}
+	s.clocks++
+	// Correct drift beyond half a clock.
+	want := s.start + float64(s.clocks)/PPQN
+	bs := s.t.BeatSamples()
+	if bs <= 0 {
+		s.t.Seek(want)
+		return
+	}
+	have := s.t.Beats() + float64(off)/bs
+	if math.Abs(want-have) > .5/PPQN {
+		s.t.Seek(want - float64(off)/bs)
+	}
+}
+
+func (s *Sync) apply(ev event, off int) {
+	switch ev.kind {
+	case clockEvent:
+		s.clock(s.pos+int64(off), off)
+	// The first clock after these messages is at the song position.
+	case startEvent:
+		s.start, s.clocks = 0, -1
+		s.t.Seek(0)
+		s.t.Start()
+	case continueEvent:
+		s.start, s.clocks = s.t.Beats(), -1
+		s.t.Start()
+	case stopEvent:
+		s.t.Stop()
+	case songPositionEvent:
+		s.start, s.clocks = float64(ev.spp)/4, -1
+		s.t.Seek(s.start)
+	}
+}
+
+// Process writes a trigger to b for every clock pulse.
+func (s *Sync) Process(b []float32) {
+	s.n++
+	evs, _ := s.iface.block(&s.n, len(b))
+	for i := range b {
+		b[i] = 0
+	}
+	for _, ev := range evs {
+		if !ev.system() {
+			continue
+		}
+		off := ev.off
+		if off >= len(b) {
+			off = len(b) - 1
+		}
+		s.apply(ev.event, off)
+		if ev.kind == clockEvent && off >= 0 {
+			b[off] = 1
+		}
+	}
+	s.pos += int64(len(b))
+}
+
+// ClockOut sends MIDI clock and transport messages following a transport.
+//
+// Clock messages are sent when processing the block containing them.
+type ClockOut struct {
+	o       *Output
+	t       *modular.Transport
+	playing bool
+	next    float64 // next pulse to send
+	pos     int64   // transport position expected at the next block
+}
+
+// Clock returns a processor sending clock from the transport t.
+//
+// Clock must be processed before the host advances the transport.
+// Clock is sent while the transport plays. Start is sent when the transport
+// starts at the beginning and Song Position Pointer and Continue otherwise.
+// When the transport is moved while playing, Stop, Song Position Pointer
+// and Continue are sent so slaves follow the new position.
+// The block b is not modified.
+func (o *Output) Clock(t *modular.Transport) *ClockOut {
+	return &ClockOut{o: o, t: t}
+}
+
+// Process sends the clock messages for the next block of size len(b).
+func (c *ClockOut) Process(b []float32) {
+	switch p := c.t.Playing(); {
+	case p != c.playing:
+		c.playing = p
+		switch beats := c.t.Beats(); {
+		case !p:
+			c.o.write(writer.RTStop)
+			return
+		case beats == 0:
+			c.next = 0
+			c.o.write(writer.RTStart)
+		default:
+			c.resume(beats)
+		}
+	case p && c.t.Pos() != c.pos:
+		// The transport was moved.
+		c.o.write(writer.RTStop)
+		c.resume(c.t.Beats())
+	}
+	c.pos = c.t.Pos() + int64(len(b))
+	bs := c.t.BeatSamples()
+	if !c.playing || bs <= 0 {
+		return
+	}
+	from := c.t.Beats() * PPQN
+	to := from + float64(len(b))/bs*PPQN
+	// Allow for rounding in the transport position.
+	const eps = 1e-9
+	for n := math.Max(math.Ceil(from-eps), c.next); n < to-eps; n++ {
+		c.o.write(writer.RTClock)
+		c.next = n + 1
+	}
+}
+
+// resume sends Song Position Pointer and Continue from the next
+// sixteenth note at or after beats.
+func (c *ClockOut) resume(beats float64) {
+	spp := uint16(math.Ceil(beats * 4))
+	c.next = float64(spp) * PPQN / 4
+	c.o.write(func(w *writer.Writer) error { return writer.SPP(w, swap7(spp)) })
+	c.o.write(writer.RTContinue)
+}
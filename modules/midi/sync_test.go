@@ -0,0 +1,107 @@
+package midi
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ajzaff/go-modular"
+)
+
+// clockOutRig runs a ClockOut on an in-memory output port.
+type clockOutRig struct {
+	t   *testing.T
+	out *MemOut
+	c   *ClockOut
+	tr  *modular.Transport
+}
+
+// newClockOutRig returns a rig with 2 samples per clock pulse at 60 BPM.
+func newClockOutRig(t *testing.T) *clockOutRig {
+	drv := NewMemDriver("test")
+	out := drv.AddOut("out")
+	o, err := NewOut(out, 0)
+	if err != nil {
+		t.Fatalf("NewOut: %v", err)
+	}
+	t.Cleanup(func() { o.Close() })
+	tr := modular.NewTransport(2 * PPQN)
+	tr.SetTempo(60)
+	return &clockOutRig{t: t, out: out, c: o.Clock(tr), tr: tr}
+}
+
+// block processes a block of n samples, advances the transport and
+// returns the messages sent with runs of clocks counted.
+func (r *clockOutRig) block(n int) []string {
+	r.out.Reset()
+	r.c.Process(make([]float32, n))
+	r.tr.Advance(n)
+	var res []string
+	clocks := 0
+	for _, m := range r.out.Messages() {
+		if bytes.Equal(m, []byte{0xf8}) {
+			clocks++
+			continue
+		}
+		if clocks > 0 {
+			res = append(res, fmt.Sprintf("clock x%d", clocks))
+			clocks = 0
+		}
+		res = append(res, fmt.Sprintf("% x", m))
+	}
+	if clocks > 0 {
+		res = append(res, fmt.Sprintf("clock x%d", clocks))
+	}
+	return res
+}
+
+func (r *clockOutRig) expect(n int, want ...string) {
+	r.t.Helper()
+	got := r.block(n)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		r.t.Errorf("got messages %q, want %q", got, want)
+	}
+}
+
+func TestClockOut(t *testing.T) {
+	r := newClockOutRig(t)
+	r.expect(2 * PPQN) // stopped
+
+	r.tr.Start()
+	r.expect(2*PPQN, "fa", "clock x24")
+	r.expect(PPQN, "clock x12")
+
+	// A seek forward to beat 4 repositions the slaves.
+	r.tr.Seek(4)
+	r.expect(2*PPQN, "fc", "f2 10 00", "fb", "clock x24")
+
+	// A seek backwards between sixteenths continues from the next one.
+	r.tr.Seek(1.1)
+	r.expect(2*PPQN, "fc", "f2 05 00", "fb", "clock x21")
+
+	r.tr.Stop()
+	r.expect(2*PPQN, "fc")
+
+	// Starting mid-song sends the position.
+	r.tr.Seek(2)
+	r.tr.Start()
+	r.expect(2*PPQN, "f2 08 00", "fb", "clock x24")
+
+	// Tempo changes are not seeks.
+	r.tr.SetTempo(120)
+	r.expect(2*PPQN, "clock x48")
+}
+
+func TestSyncSongPosition(t *testing.T) {
+	r := newTestRig(t, 0)
+	tr := modular.NewTransport(44100)
+	s := r.iface.Sync(tr)
+	r.process(s)
+
+	// Song position 133 sixteenths with the least significant byte first.
+	r.send(0, 0xf2, 0x05, 0x01)
+	r.process(s)
+	if got := tr.Beats(); got != 133./4 {
+		t.Errorf("got position %v beats, want %v", got, 133./4)
+	}
+}
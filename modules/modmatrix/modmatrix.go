@@ -0,0 +1,175 @@
+// Package modmatrix provides a modulation matrix routing CV sources to parameters.
+package modmatrix
+
+import (
+	"math"
+
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/modules/mathmod"
+)
+
+// NoVia marks a route without a via source.
+const NoVia = -1
+
+// Curves for shaping source values.
+var (
+	// Linear leaves values unchanged.
+	Linear mathmod.Func = func(x float32) float32 { return x }
+
+	// Exp is a bipolar square curve with finer control near zero.
+	Exp mathmod.Func = func(x float32) float32 { return x * float32(math.Abs(float64(x))) }
+
+	// Log is a bipolar square root curve with coarser control near zero.
+	Log mathmod.Func = func(x float32) float32 {
+		return float32(math.Copysign(math.Sqrt(math.Abs(float64(x))), float64(x)))
+	}
+
+	// Unipolar maps -1 to 1 into 0 to 1.
+	Unipolar mathmod.Func = func(x float32) float32 { return (x + 1) / 2 }
+
+	// Bipolar maps 0 to 1 into -1 to 1.
+	Bipolar mathmod.Func = func(x float32) float32 { return 2*x - 1 }
+)
+
+// Route connects a source to a destination.
+type Route struct {
+	// Src and Dst are the source and destination indices.
+	Src, Dst int
+
+	// Depth is the bipolar modulation amount.
+	Depth float32
+
+	// Via is an optional source index scaling the route or NoVia.
+	Via int
+
+	// Curve optionally shapes the source values before scaling.
+	Curve mathmod.Func
+}
+
+// Matrix routes any number of CV sources to any number of destinations.
+//
+// Each block, sources are set with SetSource and each destination
+// applies the sum of its routes to a parameter block.
+type Matrix struct {
+	srcs   [][]float32
+	dsts   []*Dest
+	routes []*Route
+}
+
+// New returns a new matrix with nsrc sources and ndst destinations.
+func New(nsrc, ndst int) *Matrix {
+	m := &Matrix{
+		srcs: make([][]float32, nsrc),
+		dsts: make([]*Dest, ndst),
+	}
+	for i := range m.dsts {
+		m.dsts[i] = &Dest{m: m, i: i}
+	}
+	return m
+}
+
+func (*Matrix) SetConfig(*modular.Config) error { return nil }
+
+// SetSource sets the CV block of source i for the current block.
+//
+// The matrix retains b until the next call to SetSource.
+// A nil block is treated as silence.
+func (m *Matrix) SetSource(i int, b []float32) {
+	m.srcs[i] = b
+}
+
+// Connect adds a route from source src to destination dst with the given depth.
+func (m *Matrix) Connect(src, dst int, depth float32) *Route {
+	if src < 0 || src >= len(m.srcs) || dst < 0 || dst >= len(m.dsts) {
+		panic("modmatrix.Matrix.Connect: route out of range")
+	}
+	r := &Route{Src: src, Dst: dst, Depth: depth, Via: NoVia}
+	m.routes = append(m.routes, r)
+	return r
+}
+
+// Disconnect removes the route r.
+func (m *Matrix) Disconnect(r *Route) {
+	for i, v := range m.routes {
+		if v == r {
+			m.routes = append(m.routes[:i], m.routes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Routes returns the routes of the matrix.
+func (m *Matrix) Routes() []*Route {
+	return m.routes
+}
+
+// Dest returns destination i.
+func (m *Matrix) Dest(i int) *Dest {
+	return m.dsts[i]
+}
+
+func (m *Matrix) source(i int) []float32 {
+	if i < 0 || i >= len(m.srcs) {
+		return nil
+	}
+	return m.srcs[i]
+}
+
+// Dest is a matrix destination.
+type Dest struct {
+	// Scale converts modulation into parameter units.
+	//
+	// The zero value is treated as 1.
+	Scale float32
+
+	// Min and Max optionally clamp the modulated parameter when Min < Max.
+	Min, Max float32
+
+	m *Matrix
+	i int
+}
+
+// Process adds the modulation routed to the destination to the parameter block b.
+func (d *Dest) Process(b []float32) {
+	scale := d.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	for _, r := range d.m.routes {
+		if r.Dst != d.i || r.Depth == 0 {
+			continue
+		}
+		src := d.m.source(r.Src)
+		if src == nil {
+			continue
+		}
+		var via []float32
+		if r.Via != NoVia {
+			if via = d.m.source(r.Via); via == nil {
+				continue
+			}
+		}
+		for j := range b {
+			if j >= len(src) || via != nil && j >= len(via) {
+				break
+			}
+			v := src[j]
+			if r.Curve != nil {
+				v = r.Curve(v)
+			}
+			if via != nil {
+				v *= via[j]
+			}
+			b[j] += scale * r.Depth * v
+		}
+	}
+	if d.Min < d.Max {
+		for j, v := range b {
+			if v < d.Min {
+				b[j] = d.Min
+			} else if v > d.Max {
+				b[j] = d.Max
+			}
+		}
+	}
+}
@@ -6,7 +6,8 @@ import (
 	"github.com/ajzaff/go-modular"
 )
 
-const noiseSeed = 1260667865
+// NoiseSeed is the default seed used for a zero State.
+const NoiseSeed = 1260667865
 
 // Xorshift32 from p. 4 of Marsaglia, "Xorshift RNGs"
 type NoiseOsc struct {
@@ -21,6 +22,17 @@ func Noise(a Polarity) *NoiseOsc {
 
 func (*NoiseOsc) SetConfig(*modular.Config) {}
 
+// Seed sets the state of the generator.
+//
+// A zero seed is replaced by NoiseSeed since Xorshift
+// stays at zero from a zero state.
+func (o *NoiseOsc) Seed(seed uint32) {
+	if seed == 0 {
+		seed = NoiseSeed
+	}
+	o.State = seed
+}
+
 func (o *NoiseOsc) Next() float32 {
 	v, x := nextRand(o.State)
 	o.State = x
@@ -37,7 +49,7 @@ func nextRand(x uint32) (v float32, state uint32) {
 func (o *NoiseOsc) Process(b []float32) {
 	x := o.State
 	if x == 0 {
-		x = noiseSeed
+		x = NoiseSeed
 	}
 	for i := range b {
 		var v float32
@@ -0,0 +1,301 @@
+// Package poly provides a polyphonic voice allocator.
+package poly
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ajzaff/go-modular"
+)
+
+// Voice is a monophonic sub-patch played by the allocator.
+//
+// Voices implementing modular.Module receive the allocator config.
+type Voice interface {
+	// NoteOn starts the voice on key with velocity vel.
+	NoteOn(key, vel uint8)
+
+	// NoteOff releases the voice.
+	NoteOff()
+
+	// Done returns true after the release tail has finished.
+	//
+	// New voices should be done until the first NoteOn.
+	Done() bool
+
+	// Process renders the next block of the voice into b.
+	Process(b []float32)
+}
+
+// Expressive is implemented by voices with per-note expression.
+type Expressive interface {
+	// Expression sets the pitch bend in semitones and
+	// the pressure and timbre in the range 0 to 1.
+	Expression(bend, pressure, timbre float32)
+}
+
+// Factory returns a new voice.
+type Factory func() Voice
+
+// Stealing selects the voice to steal when all voices are busy.
+type Stealing int
+
+const (
+	RoundRobin Stealing = iota // next voice in turn
+	Oldest                     // longest playing voice
+	Quietest                   // lowest output level
+)
+
+type slot struct {
+	v     Voice
+	ch    uint8
+	key   uint8
+	held  bool
+	age   uint64
+	level float32
+}
+
+type eventKind int
+
+const (
+	noteOnEvent eventKind = iota
+	noteOffEvent
+	expressionEvent
+	releaseEvent
+)
+
+// noteEvent is a note event queued for the audio goroutine.
+type noteEvent struct {
+	kind                   eventKind
+	ch, key, vel           uint8
+	bend, pressure, timbre float32
+}
+
+// Allocator allocates voices for incoming notes and mixes them.
+//
+// Allocator implements midi.NoteHandler and midi.MPEHandler from
+// modules/midi and is safe to feed notes from the MIDI reader goroutine.
+// Notes are identified by channel and key. NoteOn and NoteOff use channel 0.
+//
+// Note events are queued and applied to the voices at the start of the
+// next block, so voices are only called from the goroutine calling Process.
+type Allocator struct {
+	mu      sync.Mutex // guards pending and steal
+	pending []noteEvent
+	steal   Stealing
+
+	// Owned by the goroutine calling Process.
+	events []noteEvent
+	slots  []*slot
+	next   int
+	age    uint64
+	buf    []float32
+
+	active int32 // atomic
+}
+
+// New returns a new allocator with n voices created by f.
+func New(n int, f Factory) *Allocator {
+	a := &Allocator{slots: make([]*slot, n)}
+	for i := range a.slots {
+		a.slots[i] = &slot{v: f()}
+	}
+	return a
+}
+
+// SetConfig updates the config of all voices implementing modular.Module.
+func (a *Allocator) SetConfig(cfg *modular.Config) error {
+	for _, s := range a.slots {
+		if m, ok := s.v.(modular.Module); ok {
+			if err := m.SetConfig(cfg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetStealing sets the voice stealing mode.
+//
+// The default is RoundRobin.
+func (a *Allocator) SetStealing(s Stealing) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.steal = s
+}
+
+// Voices returns the number of voices.
+func (a *Allocator) Voices() int {
+	return len(a.slots)
+}
+
+// Active returns the number of voices sounding at the end of the last block.
+func (a *Allocator) Active() int {
+	return int(atomic.LoadInt32(&a.active))
+}
+
+func (a *Allocator) free(s *slot) bool {
+	return !s.held && s.v.Done()
+}
+
+// allocate returns the index of the slot to play key on channel ch.
+func (a *Allocator) allocate(ch, key uint8, steal Stealing) int {
+	// Retrigger a voice already playing the note.
+	for i, s := range a.slots {
+		if s.ch == ch && s.key == key && (s.held || !s.v.Done()) {
+			return i
+		}
+	}
+	n := len(a.slots)
+	// Prefer free voices, then released voices, then held voices.
+	for _, ok := range []func(*slot) bool{a.free, func(s *slot) bool { return !s.held }, func(*slot) bool { return true }} {
+		best := -1
+		for j := 0; j < n; j++ {
+			i := (a.next + j) % n
+			s := a.slots[i]
+			if !ok(s) {
+				continue
+			}
+			if best < 0 {
+				best = i
+			}
+			switch steal {
+			case Oldest:
+				if s.age < a.slots[best].age {
+					best = i
+				}
+			case Quietest:
+				if s.level < a.slots[best].level {
+					best = i
+				}
+			}
+			if steal == RoundRobin {
+				break
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+// queue queues the event ev for the next block.
+func (a *Allocator) queue(ev noteEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = append(a.pending, ev)
+}
+
+// NoteOn allocates a voice for key.
+func (a *Allocator) NoteOn(key, vel uint8) {
+	a.NoteOnChannel(0, key, vel)
+}
+
+// NoteOff releases the voice playing key.
+func (a *Allocator) NoteOff(key uint8) {
+	a.NoteOffChannel(0, key)
+}
+
+// NoteOnChannel allocates a voice for key on channel ch.
+func (a *Allocator) NoteOnChannel(ch, key, vel uint8) {
+	a.queue(noteEvent{kind: noteOnEvent, ch: ch, key: key, vel: vel})
+}
+
+// NoteOffChannel releases the voice playing key on channel ch.
+func (a *Allocator) NoteOffChannel(ch, key uint8) {
+	a.queue(noteEvent{kind: noteOffEvent, ch: ch, key: key})
+}
+
+// Expression sets the expression of the voice playing key on channel ch
+// if the voice implements Expressive.
+func (a *Allocator) Expression(ch, key uint8, bend, pressure, timbre float32) {
+	a.queue(noteEvent{kind: expressionEvent, ch: ch, key: key, bend: bend, pressure: pressure, timbre: timbre})
+}
+
+// Release releases all held voices.
+func (a *Allocator) Release() {
+	a.queue(noteEvent{kind: releaseEvent})
+}
+
+// apply applies the event ev to the voices.
+func (a *Allocator) apply(ev noteEvent, steal Stealing) {
+	switch ev.kind {
+	case noteOnEvent:
+		i := a.allocate(ev.ch, ev.key, steal)
+		if i < 0 {
+			return
+		}
+		a.next = (i + 1) % len(a.slots)
+		a.age++
+		s := a.slots[i]
+		s.ch, s.key, s.held, s.age = ev.ch, ev.key, true, a.age
+		s.v.NoteOn(ev.key, ev.vel)
+	case noteOffEvent:
+		for _, s := range a.slots {
+			if s.held && s.ch == ev.ch && s.key == ev.key {
+				s.held = false
+				s.v.NoteOff()
+			}
+		}
+	case expressionEvent:
+		for _, s := range a.slots {
+			if s.held && s.ch == ev.ch && s.key == ev.key {
+				if e, ok := s.v.(Expressive); ok {
+					e.Expression(ev.bend, ev.pressure, ev.timbre)
+				}
+			}
+		}
+	case releaseEvent:
+		for _, s := range a.slots {
+			if s.held {
+				s.held = false
+				s.v.NoteOff()
+			}
+		}
+	}
+}
+
+// Process applies the queued note events and mixes the next block
+// of all sounding voices into b.
+//
+// The previous contents of b are replaced.
+func (a *Allocator) Process(b []float32) {
+	a.mu.Lock()
+	a.events, a.pending = a.pending, a.events[:0]
+	steal := a.steal
+	a.mu.Unlock()
+	for _, ev := range a.events {
+		a.apply(ev, steal)
+	}
+
+	if cap(a.buf) < len(b) {
+		a.buf = make([]float32, len(b))
+	}
+	buf := a.buf[:len(b)]
+	for i := range b {
+		b[i] = 0
+	}
+	var active int32
+	for _, s := range a.slots {
+		if !s.held && s.v.Done() {
+			s.level = 0
+			continue
+		}
+		for i := range buf {
+			buf[i] = 0
+		}
+		s.v.Process(buf)
+		var level float32
+		for i, v := range buf {
+			b[i] += v
+			level = float32(math.Max(float64(level), math.Abs(float64(v))))
+		}
+		s.level = level
+		if s.held || !s.v.Done() {
+			active++
+		}
+	}
+	atomic.StoreInt32(&a.active, active)
+}
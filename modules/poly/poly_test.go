@@ -0,0 +1,126 @@
+package poly
+
+import (
+	"sync"
+	"testing"
+)
+
+// testVoice outputs its key while held and for one block after release.
+type testVoice struct {
+	key      uint8
+	held     bool
+	tail     int
+	bend     float32
+	noteOns  int
+	noteOffs int
+}
+
+func (v *testVoice) NoteOn(key, vel uint8) {
+	v.key, v.held, v.tail = key, true, 1
+	v.noteOns++
+}
+
+func (v *testVoice) NoteOff() {
+	v.held = false
+	v.noteOffs++
+}
+
+func (v *testVoice) Done() bool {
+	return !v.held && v.tail == 0
+}
+
+func (v *testVoice) Expression(bend, pressure, timbre float32) {
+	v.bend = bend
+}
+
+func (v *testVoice) Process(b []float32) {
+	if !v.held {
+		if v.tail == 0 {
+			return
+		}
+		v.tail--
+	}
+	for i := range b {
+		b[i] = float32(v.key)
+	}
+}
+
+func newTestAllocator(n int) (*Allocator, []*testVoice) {
+	var voices []*testVoice
+	a := New(n, func() Voice {
+		v := &testVoice{}
+		voices = append(voices, v)
+		return v
+	})
+	return a, voices
+}
+
+func TestAllocator(t *testing.T) {
+	a, voices := newTestAllocator(2)
+	b := make([]float32, 4)
+
+	a.NoteOn(60, 100)
+	a.NoteOn(64, 100)
+	if voices[0].noteOns != 0 {
+		t.Errorf("voice started before the block")
+	}
+	a.Process(b)
+	if b[0] != 124 || a.Active() != 2 {
+		t.Errorf("got mix %v with %d voices, want 124 with 2", b[0], a.Active())
+	}
+
+	// Stealing the first voice round robin.
+	a.NoteOn(67, 100)
+	a.Process(b)
+	if b[0] != 131 || voices[0].key != 67 {
+		t.Errorf("got mix %v with voice keys %d %d, want 131 with 67 64", b[0], voices[0].key, voices[1].key)
+	}
+
+	a.NoteOff(64)
+	a.Process(b) // release tail
+	a.Process(b)
+	if b[0] != 67 || a.Active() != 1 {
+		t.Errorf("got mix %v with %d voices, want 67 with 1", b[0], a.Active())
+	}
+
+	a.Release()
+	a.Process(b)
+	a.Process(b)
+	if b[0] != 0 || a.Active() != 0 {
+		t.Errorf("got mix %v with %d voices after Release, want 0 with 0", b[0], a.Active())
+	}
+}
+
+func TestAllocatorChannels(t *testing.T) {
+	a, voices := newTestAllocator(4)
+	b := make([]float32, 4)
+	a.NoteOnChannel(1, 60, 100)
+	a.NoteOnChannel(2, 60, 100)
+	a.Expression(1, 60, 2, 0, 0)
+	a.NoteOffChannel(2, 60)
+	a.Process(b)
+	if voices[0].bend != 2 || voices[1].bend != 0 {
+		t.Errorf("got bends %v %v, want 2 0", voices[0].bend, voices[1].bend)
+	}
+	if !voices[0].held || voices[1].held {
+		t.Errorf("got held %v %v, want true false", voices[0].held, voices[1].held)
+	}
+}
+
+func TestAllocatorConcurrent(t *testing.T) {
+	a, _ := newTestAllocator(4)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			a.NoteOn(uint8(i%128), 100)
+			a.NoteOff(uint8(i % 128))
+		}
+	}()
+	b := make([]float32, 64)
+	for i := 0; i < 1000; i++ {
+		a.Process(b)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,101 @@
+// Package quant provides a pitch quantizer for one-volt-per-octave CVs.
+package quant
+
+import (
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/midi"
+)
+
+// Quantizer snaps one-volt-per-octave CV to the notes of a scale.
+//
+// Process replaces the CV block with the quantized CV and
+// Triggers outputs the note changes of the block.
+type Quantizer struct {
+	// Scale is the set of allowed notes.
+	Scale midi.Scale
+
+	// Root is the root note of the scale (e.g. midi.C).
+	Root int
+
+	// Tuning is used to compute the frequency of the quantized note.
+	Tuning midi.Tuning
+
+	key   int
+	trig  bool
+	init  bool
+	trigs []float32 // triggers of the last block
+}
+
+// New returns a new quantizer for scale s with the given root note.
+func New(s midi.Scale, root int) *Quantizer {
+	return &Quantizer{
+		Scale:  s,
+		Root:   root,
+		Tuning: midi.StdTuning,
+	}
+}
+
+func (*Quantizer) SetConfig(*modular.Config) error { return nil }
+
+// Key returns the current quantized midi key.
+func (q *Quantizer) Key() int {
+	return q.key
+}
+
+// Voltage returns the current quantized CV.
+func (q *Quantizer) Voltage() float32 {
+	return float32(q.key) / 12
+}
+
+// Hz returns the frequency of the current quantized note in the tuning.
+func (q *Quantizer) Hz() float32 {
+	return midi.Pitch(q.Tuning, q.key)
+}
+
+// Trig returns true if the quantized note changed on the last sample.
+//
+// Trig follows Next. Use Triggers for the changes within a block.
+func (q *Quantizer) Trig() bool {
+	return q.trig
+}
+
+// Triggers returns a processor filling the block with the triggers of the
+// last block processed by the quantizer: 1 on the samples where the
+// quantized note changed and 0 elsewhere.
+//
+// It must be processed after the quantizer in each block.
+func (q *Quantizer) Triggers() modular.Processor {
+	return triggers{q}
+}
+
+type triggers struct {
+	q *Quantizer
+}
+
+func (t triggers) Process(b []float32) {
+	n := copy(b, t.q.trigs)
+	for i := n; i < len(b); i++ {
+		b[i] = 0
+	}
+}
+
+// Next returns the quantized CV for input v.
+func (q *Quantizer) Next(v float32) float32 {
+	k := q.Scale.Quantize(q.Root, 12*v)
+	q.trig = !q.init || k != q.key
+	q.key, q.init = k, true
+	return q.Voltage()
+}
+
+// Process replaces the CV block with the quantized CV.
+func (q *Quantizer) Process(b []float32) {
+	q.trigs = q.trigs[:0]
+	for i, v := range b {
+		b[i] = q.Next(v)
+		var t float32
+		if q.trig {
+			t = 1
+		}
+		q.trigs = append(q.trigs, t)
+	}
+}
@@ -0,0 +1,34 @@
+package quant
+
+import (
+	"testing"
+
+	"github.com/ajzaff/go-modular/midi"
+)
+
+func TestTriggers(t *testing.T) {
+	q := New(midi.Major, midi.C)
+	trigs := q.Triggers()
+
+	// C4, C4, D4, D4 from a flat D4, E4.
+	b := []float32{60. / 12, 60. / 12, 62. / 12, 61.8 / 12, 64. / 12}
+	q.Process(b)
+	tb := make([]float32, len(b))
+	trigs.Process(tb)
+	for i, want := range []float32{1, 0, 1, 0, 1} {
+		if tb[i] != want {
+			t.Errorf("sample %d: got trigger %v, want %v", i, tb[i], want)
+		}
+	}
+	if want := float32(64) / 12; b[4] != want {
+		t.Errorf("got CV %v, want %v", b[4], want)
+	}
+
+	q.Process(b[:2])
+	trigs.Process(tb)
+	for i, want := range []float32{1, 0, 0, 0, 0} {
+		if tb[i] != want {
+			t.Errorf("second block sample %d: got trigger %v, want %v", i, tb[i], want)
+		}
+	}
+}
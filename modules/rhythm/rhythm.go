@@ -0,0 +1,177 @@
+// Package rhythm provides Euclidean and probabilistic rhythm generators.
+//
+// Rhythm generators route an incoming clock gate to their outputs.
+// A clock sample is high when positive.
+package rhythm
+
+import (
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/modules/osc"
+)
+
+// Pattern returns the Euclidean rhythm with the given number of steps,
+// pulses and rotation.
+//
+// Pulses are distributed as evenly as possible across the steps and
+// the pattern is rotated right by rotation steps.
+func Pattern(steps, pulses, rotation int) []bool {
+	if steps <= 0 {
+		return nil
+	}
+	if pulses < 0 {
+		pulses = 0
+	} else if pulses > steps {
+		pulses = steps
+	}
+	rotation %= steps
+	if rotation < 0 {
+		rotation += steps
+	}
+	p := make([]bool, steps)
+	for i := range p {
+		j := (i - rotation + steps) % steps
+		p[i] = j*pulses%steps < pulses
+	}
+	return p
+}
+
+// Euclid is a Euclidean rhythm generator.
+//
+// Each rising clock edge advances one step. The clock passes
+// through to the output on steps with a pulse.
+type Euclid struct {
+	pattern []bool
+	pos     int
+	clockOn bool
+	gate    bool
+	trig    bool
+}
+
+// NewEuclid returns a new Euclidean rhythm generator.
+func NewEuclid(steps, pulses, rotation int) *Euclid {
+	e := &Euclid{pos: -1}
+	e.Set(steps, pulses, rotation)
+	return e
+}
+
+func (*Euclid) SetConfig(*modular.Config) error { return nil }
+
+// Set updates the number of steps, pulses and rotation.
+func (e *Euclid) Set(steps, pulses, rotation int) {
+	e.pattern = Pattern(steps, pulses, rotation)
+	if e.pos >= len(e.pattern) {
+		e.pos = -1
+	}
+}
+
+// Reset returns to the first step on the next clock.
+func (e *Euclid) Reset() {
+	e.pos = -1
+}
+
+// Pos returns the current step.
+func (e *Euclid) Pos() int {
+	return e.pos
+}
+
+// Gate returns true while the clock is high on a pulse step.
+func (e *Euclid) Gate() bool {
+	return e.gate
+}
+
+// Trig returns true on the first clock sample of a pulse step.
+//
+// Trig follows the clock sample passed to the last call to Next.
+func (e *Euclid) Trig() bool {
+	return e.trig
+}
+
+// Next returns the output gate for the clock sample v.
+func (e *Euclid) Next(v float32) float32 {
+	on := v > 0
+	e.trig = false
+	if on && !e.clockOn && len(e.pattern) > 0 {
+		e.pos = (e.pos + 1) % len(e.pattern)
+		e.trig = e.pattern[e.pos]
+	}
+	e.clockOn = on
+	e.gate = on && e.pos >= 0 && e.pos < len(e.pattern) && e.pattern[e.pos]
+	if e.gate {
+		return 1
+	}
+	return 0
+}
+
+// Process replaces the clock block with the output gates.
+func (e *Euclid) Process(b []float32) {
+	for i, v := range b {
+		b[i] = e.Next(v)
+	}
+}
+
+// Bernoulli is a Bernoulli gate.
+//
+// On each rising clock edge a coin is tossed and the clock is
+// routed to output A with probability P and to output B otherwise.
+type Bernoulli struct {
+	// P is the probability of routing the clock to output A.
+	P float32
+
+	rand    osc.NoiseOsc
+	clockOn bool
+	a       bool
+	outA    bool
+	outB    bool
+	trig    bool
+}
+
+// NewBernoulli returns a new Bernoulli gate with probability p.
+func NewBernoulli(p float32) *Bernoulli {
+	return &Bernoulli{P: p, rand: osc.NoiseOsc{State: osc.NoiseSeed, A: .5, C: .5}}
+}
+
+func (*Bernoulli) SetConfig(*modular.Config) error { return nil }
+
+// Seed seeds the random source.
+//
+// A zero seed restores the default seed.
+func (g *Bernoulli) Seed(seed uint32) {
+	g.rand.Seed(seed)
+}
+
+// A returns true while the clock is routed to output A and high.
+func (g *Bernoulli) A() bool {
+	return g.outA
+}
+
+// B returns true while the clock is routed to output B and high.
+func (g *Bernoulli) B() bool {
+	return g.outB
+}
+
+// Trig returns true on the first sample of each routed clock gate.
+func (g *Bernoulli) Trig() bool {
+	return g.trig
+}
+
+// Next returns the gate of output A for the clock sample v.
+func (g *Bernoulli) Next(v float32) float32 {
+	on := v > 0
+	g.trig = on && !g.clockOn
+	if g.trig {
+		g.a = g.rand.Next() < g.P
+	}
+	g.clockOn = on
+	g.outA, g.outB = on && g.a, on && !g.a
+	if g.outA {
+		return 1
+	}
+	return 0
+}
+
+// Process replaces the clock block with the gates of output A.
+func (g *Bernoulli) Process(b []float32) {
+	for i, v := range b {
+		b[i] = g.Next(v)
+	}
+}
@@ -0,0 +1,44 @@
+package rhythm
+
+import "testing"
+
+// split clocks the gate n times and counts the clocks routed to A and B.
+func split(g *Bernoulli, n int) (a, b int) {
+	for i := 0; i < n; i++ {
+		g.Next(1)
+		switch {
+		case g.A():
+			a++
+		case g.B():
+			b++
+		}
+		g.Next(0)
+	}
+	return a, b
+}
+
+func TestBernoulli(t *testing.T) {
+	for _, tc := range []struct {
+		p        float32
+		min, max int
+	}{
+		{0, 0, 0},
+		{1, 400, 400},
+		{.5, 160, 240},
+		{.1, 20, 60},
+	} {
+		a, b := split(NewBernoulli(tc.p), 400)
+		if a < tc.min || a > tc.max || a+b != 400 {
+			t.Errorf("P %v: got %d A and %d B out of 400, want %d to %d A", tc.p, a, b, tc.min, tc.max)
+		}
+	}
+}
+
+func TestBernoulliSeed(t *testing.T) {
+	g := NewBernoulli(.5)
+	want, _ := split(g, 100)
+	g.Seed(0)
+	if a, _ := split(g, 100); a != want {
+		t.Errorf("Seed(0): got %d A, want the default %d", a, want)
+	}
+}
@@ -0,0 +1,258 @@
+// Package seq provides a step sequencer.
+package seq
+
+import (
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/modules/clock"
+	"github.com/ajzaff/go-modular/modules/osc"
+)
+
+// MaxSteps is the maximum number of sequencer steps.
+const MaxSteps = 64
+
+// Step is a single sequencer step.
+type Step struct {
+	// Key is the midi key of the step.
+	Key int
+
+	// Gate is the gate length as a fraction of the step.
+	//
+	// Zero is a rest and 1 or more ties into the next step.
+	Gate float32
+
+	// Accent marks the step as accented.
+	Accent bool
+
+	// Prob is the probability the step plays.
+	//
+	// Zero is treated as 1 so that steps play by default.
+	Prob float32
+}
+
+// Direction controls the order steps are played in.
+type Direction int
+
+const (
+	Forward  Direction = iota // 0, 1, 2, 3, 0, ...
+	Reverse                   // 3, 2, 1, 0, 3, ...
+	PingPong                  // 0, 1, 2, 3, 2, 1, 0, ...
+	Random                    // random steps
+)
+
+// Sequencer is a step sequencer outputting pitch CV and gates.
+//
+// The sequencer is advanced by the clock if set or the internal tempo.
+type Sequencer struct {
+	steps [MaxSteps]Step
+	n     int
+	dir   Direction
+
+	clock clock.Stepper
+
+	pos     int
+	delta   int
+	started bool
+	play    bool
+	key     int
+	trig    bool
+
+	rand osc.NoiseOsc
+}
+
+// New returns a new sequencer with the given steps.
+//
+// It panics if more than MaxSteps steps are given.
+func New(steps ...Step) *Sequencer {
+	s := &Sequencer{
+		clock: clock.NewStepper(),
+		rand:  osc.NoiseOsc{State: osc.NoiseSeed, A: .5, C: .5},
+	}
+	s.SetSteps(steps...)
+	s.Reset()
+	return s
+}
+
+func (s *Sequencer) SetConfig(cfg *modular.Config) error {
+	s.clock.SetConfig(cfg)
+	s.Reset()
+	return nil
+}
+
+// SetSteps replaces the steps of the sequence and sets the length to len(steps).
+func (s *Sequencer) SetSteps(steps ...Step) {
+	if len(steps) > MaxSteps {
+		panic("seq.Sequencer.SetSteps: too many steps")
+	}
+	copy(s.steps[:], steps)
+	s.n = len(steps)
+}
+
+// SetStep sets the step at index i.
+func (s *Sequencer) SetStep(i int, st Step) {
+	s.steps[i] = st
+}
+
+// Step returns the step at index i.
+func (s *Sequencer) Step(i int) Step {
+	return s.steps[i]
+}
+
+// Len returns the sequence length.
+func (s *Sequencer) Len() int {
+	return s.n
+}
+
+// SetLen sets the sequence length to n steps.
+func (s *Sequencer) SetLen(n int) {
+	if n < 0 || n > MaxSteps {
+		panic("seq.Sequencer.SetLen: length out of range")
+	}
+	s.n = n
+}
+
+// SetDirection sets the playback direction.
+func (s *Sequencer) SetDirection(d Direction) {
+	s.dir = d
+}
+
+// SetTempo sets the internal tempo as in clock.Stepper.SetTempo.
+func (s *Sequencer) SetTempo(bpm, stepsPerBeat float32) {
+	s.clock.SetTempo(bpm, stepsPerBeat)
+}
+
+// ResetClock unsets the clock input and uses the internal tempo.
+func (s *Sequencer) ResetClock() {
+	s.clock.ResetClock()
+}
+
+// SetClock sets the clock input.
+//
+//	clock will be called once per sample.
+//	A rising edge advances the sequencer.
+func (s *Sequencer) SetClock(clock func() bool) {
+	s.clock.SetClock(clock)
+}
+
+// Seed seeds the random source used by Random and step probabilities.
+//
+// A zero seed restores the default seed.
+func (s *Sequencer) Seed(seed uint32) {
+	s.rand.Seed(seed)
+}
+
+// Reset returns the sequencer to the start of the sequence.
+func (s *Sequencer) Reset() {
+	s.started = false
+	s.delta = 1
+	s.play = false
+	s.trig = false
+	s.clock.Reset()
+}
+
+func (s *Sequencer) next() int {
+	n := s.n
+	if !s.started {
+		s.started = true
+		switch s.dir {
+		case Reverse:
+			return n - 1
+		case Random:
+		default:
+			return 0
+		}
+	}
+	switch s.dir {
+	case Reverse:
+		return (s.pos - 1 + n) % n
+	case PingPong:
+		if n == 1 {
+			return 0
+		}
+		pos := s.pos + s.delta
+		if pos >= n {
+			s.delta = -1
+			pos = n - 2
+		} else if pos < 0 {
+			s.delta = 1
+			pos = 1
+		}
+		return pos
+	case Random:
+		pos := int(s.rand.Next() * float32(n))
+		if pos >= n {
+			pos = n - 1
+		}
+		return pos
+	default:
+		return (s.pos + 1) % n
+	}
+}
+
+func (s *Sequencer) advance() {
+	s.trig = false
+	if s.n == 0 {
+		s.play = false
+		return
+	}
+	s.pos = s.next()
+	st := s.steps[s.pos]
+	s.play = st.Gate > 0 && (st.Prob <= 0 || st.Prob >= 1 || s.rand.Next() < st.Prob)
+	if s.play {
+		s.key = st.Key
+		s.trig = true
+	}
+}
+
+// Next advances the sequencer one sample and returns the pitch CV.
+func (s *Sequencer) Next() float32 {
+	s.trig = false
+	if s.clock.Next() {
+		s.advance()
+	}
+	return s.Voltage()
+}
+
+// Pos returns the index of the current step.
+func (s *Sequencer) Pos() int {
+	return s.pos
+}
+
+// Key returns the midi key of the last played step.
+func (s *Sequencer) Key() int {
+	return s.key
+}
+
+// Voltage returns the pitch CV of the last played step.
+//
+// Voltage uses the one-volt-per-octave standard compatible with osc.Osc.Voltage.
+func (s *Sequencer) Voltage() float32 {
+	return float32(s.key) / 12
+}
+
+// Gate returns true while the gate of the current step is open.
+func (s *Sequencer) Gate() bool {
+	if !s.play {
+		return false
+	}
+	return s.clock.Gate(s.steps[s.pos].Gate)
+}
+
+// Trig returns true on the first sample of a played step.
+//
+// Trig reflects the last call to Next. When driving an envelope,
+// read it after each Next as in examples/modules/seq.
+func (s *Sequencer) Trig() bool {
+	return s.trig
+}
+
+// Accent returns true if the current step is accented and playing.
+func (s *Sequencer) Accent() bool {
+	return s.play && s.steps[s.pos].Accent
+}
+
+// Process fills the block with pitch CV.
+func (s *Sequencer) Process(b []float32) {
+	for i := range b {
+		b[i] = s.Next()
+	}
+}
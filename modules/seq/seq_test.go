@@ -0,0 +1,121 @@
+package seq
+
+import "testing"
+
+// clocked returns a sequencer advanced by a clock with a rising edge
+// on every other sample.
+func clocked(steps ...Step) *Sequencer {
+	s := New(steps...)
+	on := false
+	s.SetClock(func() bool {
+		on = !on
+		return on
+	})
+	return s
+}
+
+// run clocks the sequencer n steps and returns the position and
+// trigger of each step.
+func run(s *Sequencer, n int) (pos []int, trigs int) {
+	for i := 0; i < n; i++ {
+		s.Next()
+		pos = append(pos, s.Pos())
+		if s.Trig() {
+			trigs++
+		}
+		s.Next()
+	}
+	return pos, trigs
+}
+
+func steps(n int, st Step) []Step {
+	res := make([]Step, n)
+	for i := range res {
+		res[i] = st
+		res[i].Key = 60 + i
+	}
+	return res
+}
+
+func TestForward(t *testing.T) {
+	s := clocked(steps(4, Step{Gate: .5})...)
+	pos, trigs := run(s, 6)
+	for i, want := range []int{0, 1, 2, 3, 0, 1} {
+		if pos[i] != want {
+			t.Errorf("step %d: got position %d, want %d", i, pos[i], want)
+		}
+	}
+	if trigs != 6 {
+		t.Errorf("got %d triggers, want 6", trigs)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	const n = 400
+	s := clocked(steps(8, Step{Gate: .5})...)
+	s.SetDirection(Random)
+	pos, trigs := run(s, n)
+	var count [8]int
+	for _, p := range pos {
+		if p < 0 || p >= 8 {
+			t.Fatalf("got position %d, want 0 to 7", p)
+		}
+		count[p]++
+	}
+	// Every step is played about n/8 times.
+	for p, c := range count {
+		if c < n/16 || c > n/4 {
+			t.Errorf("position %d played %d times out of %d", p, c, n)
+		}
+	}
+	if trigs != n {
+		t.Errorf("got %d triggers, want %d", trigs, n)
+	}
+}
+
+func TestProb(t *testing.T) {
+	for _, tc := range []struct {
+		prob     float32
+		min, max int
+	}{
+		{0, 400, 400},
+		{1, 400, 400},
+		{.1, 20, 60},
+		{.5, 160, 240},
+	} {
+		s := clocked(steps(4, Step{Gate: .5, Prob: tc.prob})...)
+		if _, trigs := run(s, 400); trigs < tc.min || trigs > tc.max {
+			t.Errorf("Prob %v: got %d triggers out of 400, want %d to %d", tc.prob, trigs, tc.min, tc.max)
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	positions := func(seed uint32) []int {
+		s := clocked(steps(8, Step{Gate: .5})...)
+		s.SetDirection(Random)
+		s.Seed(seed)
+		pos, _ := run(s, 32)
+		return pos
+	}
+	equal := func(a, b []int) bool {
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+	s := clocked(steps(8, Step{Gate: .5})...)
+	s.SetDirection(Random)
+	def, _ := run(s, 32)
+	if !equal(positions(0), def) {
+		t.Errorf("Seed(0) differs from the default seed")
+	}
+	if !equal(positions(7), positions(7)) {
+		t.Errorf("the same seed gives different sequences")
+	}
+	if equal(positions(7), def) {
+		t.Errorf("seed 7 gives the default sequence")
+	}
+}
@@ -0,0 +1,150 @@
+// Package slew provides slew limiting and portamento for CVs.
+package slew
+
+import (
+	"math"
+	"time"
+
+	"github.com/ajzaff/go-modular"
+)
+
+// Mode selects the slew response.
+type Mode int
+
+const (
+	// Linear slews at a constant rate.
+	//
+	// Rise and fall times are the times taken to move one volt.
+	// Pitch CVs from modules/midi are at one volt per octave,
+	// so a semitone glide takes a twelfth of the time.
+	Linear Mode = iota
+
+	// Exponential slews in constant time.
+	//
+	// Rise and fall times are the time constants of the lag,
+	// regardless of the interval.
+	Exponential
+)
+
+// Slew is a slew limiter with independent rise and fall times.
+//
+// Process replaces the CV block with the slewed CV.
+type Slew struct {
+	mode       Mode
+	rise, fall time.Duration
+	legato     bool
+	gate       func() bool
+	gateOn     bool
+
+	v          float32
+	init       bool
+	sampleRate int
+}
+
+// New returns a new slew limiter.
+func New(mode Mode, rise, fall time.Duration) *Slew {
+	return &Slew{
+		mode:       mode,
+		rise:       rise,
+		fall:       fall,
+		sampleRate: 44100,
+	}
+}
+
+// Glide returns a new slew limiter for portamento with equal rise and fall times.
+func Glide(mode Mode, d time.Duration) *Slew {
+	return New(mode, d, d)
+}
+
+func (s *Slew) SetConfig(cfg *modular.Config) error {
+	s.sampleRate = cfg.SampleRate
+	return nil
+}
+
+// SetRise sets the rise time.
+func (s *Slew) SetRise(d time.Duration) {
+	s.rise = d
+}
+
+// SetFall sets the fall time.
+func (s *Slew) SetFall(d time.Duration) {
+	s.fall = d
+}
+
+// ResetGate unsets the gate.
+func (s *Slew) ResetGate() {
+	s.gate = nil
+}
+
+// SetGate sets the gate used in legato mode.
+//
+//	gate will be called once per sample.
+func (s *Slew) SetGate(gate func() bool) {
+	s.gate = gate
+}
+
+// SetLegato enables or disables legato mode.
+//
+// In legato mode the slew only applies while the gate is held
+// from a previous note. The CV jumps on a new gate.
+func (s *Slew) SetLegato(legato bool) {
+	s.legato = legato
+}
+
+// Reset jumps to the next input value on the next sample.
+func (s *Slew) Reset() {
+	s.init = false
+}
+
+// Value returns the current output value.
+func (s *Slew) Value() float32 {
+	return s.v
+}
+
+func (s *Slew) samples(d time.Duration) float64 {
+	return d.Seconds() * float64(s.sampleRate)
+}
+
+// Next returns the slewed value after input v.
+func (s *Slew) Next(v float32) float32 {
+	jump := !s.init
+	if s.gate != nil {
+		on := s.gate()
+		if s.legato && on && !s.gateOn {
+			jump = true
+		}
+		s.gateOn = on
+	}
+	if jump {
+		s.v, s.init = v, true
+		return s.v
+	}
+	d := s.fall
+	if v > s.v {
+		d = s.rise
+	}
+	n := s.samples(d)
+	if n <= 0 {
+		s.v = v
+		return s.v
+	}
+	switch s.mode {
+	case Exponential:
+		s.v = v + (s.v-v)*float32(math.Exp(-1/n))
+	default:
+		step := float32(1 / n)
+		if v > s.v {
+			s.v = float32(math.Min(float64(s.v+step), float64(v)))
+		} else {
+			s.v = float32(math.Max(float64(s.v-step), float64(v)))
+		}
+	}
+	return s.v
+}
+
+// Process replaces the CV block with the slewed CV.
+func (s *Slew) Process(b []float32) {
+	for i, v := range b {
+		b[i] = s.Next(v)
+	}
+}
@@ -0,0 +1,149 @@
+// Package turing provides a looping shift register random sequencer.
+package turing
+
+import (
+	"github.com/ajzaff/go-modular"
+	"github.com/ajzaff/go-modular/modules/osc"
+)
+
+// MaxLen is the maximum shift register length.
+const MaxLen = 32
+
+// Machine is a shift register random sequencer.
+//
+// On each rising clock edge the register rotates by one bit.
+// The recycled bit flips with the change probability, so 0 locks
+// the loop and 1 doubles its length with the inverted pattern.
+type Machine struct {
+	// Change is the probability of flipping the recycled bit.
+	Change float32
+
+	// Low and High set the CV range in volts.
+	//
+	// The default is one octave from C4 (5 to 6 volts).
+	Low, High float32
+
+	reg     uint32
+	n       int
+	clock   func() bool
+	clockOn bool
+	trig    bool
+
+	rand osc.NoiseOsc
+}
+
+// New returns a new shift register of length n with the given change probability.
+//
+// The register is filled from the random source.
+// Use Seed for a different reproducible pattern.
+func New(n int, change float32) *Machine {
+	m := &Machine{
+		Change: change,
+		Low:    5,
+		High:   6,
+		rand:   osc.NoiseOsc{State: osc.NoiseSeed, A: .5, C: .5},
+	}
+	m.SetLen(n)
+	m.fill()
+	return m
+}
+
+func (*Machine) SetConfig(*modular.Config) error { return nil }
+
+func (m *Machine) fill() {
+	m.reg = 0
+	for i := 0; i < MaxLen; i++ {
+		if m.rand.Next() < .5 {
+			m.reg |= 1 << uint(i)
+		}
+	}
+}
+
+// Seed seeds the random source and refills the register.
+//
+// A zero seed restores the default seed like osc.NoiseOsc.
+func (m *Machine) Seed(seed uint32) {
+	m.rand.Seed(seed)
+	m.fill()
+}
+
+// Len returns the register length.
+func (m *Machine) Len() int {
+	return m.n
+}
+
+// SetLen sets the register length.
+func (m *Machine) SetLen(n int) {
+	if n < 1 || n > MaxLen {
+		panic("turing.Machine.SetLen: length out of range")
+	}
+	m.n = n
+}
+
+// ResetClock unsets the clock input.
+func (m *Machine) ResetClock() {
+	m.clock = nil
+}
+
+// SetClock sets the clock input.
+//
+//	clock will be called once per sample.
+//	A rising edge shifts the register.
+func (m *Machine) SetClock(clock func() bool) {
+	m.clock = clock
+}
+
+// Register returns the register bits.
+func (m *Machine) Register() uint32 {
+	return m.reg & (1<<uint(m.n) - 1)
+}
+
+// Shift rotates the register now.
+func (m *Machine) Shift() {
+	last := m.reg >> uint(m.n-1) & 1
+	if m.rand.Next() < m.Change {
+		last ^= 1
+	}
+	m.reg = m.reg<<1 | last
+}
+
+// Value returns the 8 lowest bits of the register in the range 0 to 1.
+func (m *Machine) Value() float32 {
+	return float32(m.reg&0xff) / 0xff
+}
+
+// Voltage returns the stepped CV in the range Low to High.
+func (m *Machine) Voltage() float32 {
+	return m.Low + (m.High-m.Low)*m.Value()
+}
+
+// Bit returns true if bit i is set while the clock is high.
+func (m *Machine) Bit(i int) bool {
+	return m.clockOn && m.reg>>uint(i)&1 == 1
+}
+
+// Trig returns true on the first sample of each clock.
+func (m *Machine) Trig() bool {
+	return m.trig
+}
+
+// Next advances the machine one sample and returns the stepped CV.
+func (m *Machine) Next() float32 {
+	m.trig = false
+	if m.clock != nil {
+		on := m.clock()
+		if on && !m.clockOn {
+			m.Shift()
+			m.trig = true
+		}
+		m.clockOn = on
+	}
+	return m.Voltage()
+}
+
+// Process fills the block with the stepped CV.
+func (m *Machine) Process(b []float32) {
+	for i := range b {
+		b[i] = m.Next()
+	}
+}
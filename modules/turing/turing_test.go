@@ -0,0 +1,39 @@
+package turing
+
+import "testing"
+
+func TestFill(t *testing.T) {
+	m := New(8, 0)
+	if r := m.Register(); r == 0 || r == 0xff {
+		t.Errorf("got register %#x, want random bits", r)
+	}
+	def := m.Register()
+	m.Seed(0)
+	if r := m.Register(); r != def {
+		t.Errorf("Seed(0): got register %#x, want the default %#x", r, def)
+	}
+}
+
+func TestChange(t *testing.T) {
+	for _, tc := range []struct {
+		change   float32
+		min, max int
+	}{
+		{0, 0, 0},
+		{1, 200, 200},
+		{.25, 25, 75},
+	} {
+		m := New(8, tc.change)
+		flips := 0
+		for i := 0; i < 200; i++ {
+			last := m.reg >> 7 & 1
+			m.Shift()
+			if m.reg&1 != last {
+				flips++
+			}
+		}
+		if flips < tc.min || flips > tc.max {
+			t.Errorf("Change %v: got %d flips out of 200, want %d to %d", tc.change, flips, tc.min, tc.max)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package modular
+
+// Transport provides a shared tempo, time signature and song position.
+//
+// The host advances the transport once per block after processing
+// all modules. Modules read the transport from Config.
+type Transport struct {
+	sampleRate int
+	cfg        *Config
+
+	bpm     float64
+	num     int
+	denom   int
+	playing bool
+	pos     int64
+	beats   float64
+}
+
+// NewTransport returns a new stopped transport at 120 BPM in 4/4
+// playing sampleRate samples per second.
+func NewTransport(sampleRate int) *Transport {
+	return &Transport{
+		sampleRate: sampleRate,
+		bpm:        120,
+		num:        4,
+		denom:      4,
+	}
+}
+
+// SetConfig makes the transport follow the SampleRate of cfg.
+func (t *Transport) SetConfig(cfg *Config) error {
+	t.cfg = cfg
+	return nil
+}
+
+// SampleRate returns the number of samples played per second.
+func (t *Transport) SampleRate() int {
+	if t.cfg != nil {
+		return t.cfg.SampleRate
+	}
+	return t.sampleRate
+}
+
+// Tempo returns the tempo in beats per minute.
+func (t *Transport) Tempo() float64 {
+	return t.bpm
+}
+
+// SetTempo sets the tempo in beats per minute.
+func (t *Transport) SetTempo(bpm float64) {
+	t.bpm = bpm
+}
+
+// TimeSignature returns the time signature.
+func (t *Transport) TimeSignature() (num, denom int) {
+	return t.num, t.denom
+}
+
+// SetTimeSignature sets the time signature to num beats of 1/denom notes.
+func (t *Transport) SetTimeSignature(num, denom int) {
+	if num <= 0 || denom <= 0 {
+		panic("modular.Transport.SetTimeSignature: invalid time signature")
+	}
+	t.num, t.denom = num, denom
+}
+
+// Start starts the transport from the current position.
+func (t *Transport) Start() {
+	t.playing = true
+}
+
+// Stop stops the transport keeping the current position.
+func (t *Transport) Stop() {
+	t.playing = false
+}
+
+// Reset returns the transport to the start of the song.
+func (t *Transport) Reset() {
+	t.pos = 0
+	t.beats = 0
+}
+
+// Playing returns true if the transport is started.
+func (t *Transport) Playing() bool {
+	return t.playing
+}
+
+// Pos returns the song position in samples.
+func (t *Transport) Pos() int64 {
+	return t.pos
+}
+
+// Beats returns the song position in beats.
+func (t *Transport) Beats() float64 {
+	return t.beats
+}
+
+// Bar returns the zero-based bar and the beat within the bar.
+func (t *Transport) Bar() (bar int, beat float64) {
+	bar = int(t.beats) / t.num
+	return bar, t.beats - float64(bar*t.num)
+}
+
+// Seek sets the song position to the given beat.
+func (t *Transport) Seek(beats float64) {
+	t.beats = beats
+	t.pos = int64(beats * t.BeatSamples())
+}
+
+// BeatSamples returns the length of a beat in samples at the current tempo.
+func (t *Transport) BeatSamples() float64 {
+	if t.bpm <= 0 {
+		return 0
+	}
+	return 60 * float64(t.SampleRate()) / t.bpm
+}
+
+// Advance advances the song position by n samples if playing.
+func (t *Transport) Advance(n int) {
+	if !t.playing {
+		return
+	}
+	t.pos += int64(n)
+	if s := t.BeatSamples(); s > 0 {
+		t.beats += float64(n) / s
+	}
+}